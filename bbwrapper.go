@@ -8,7 +8,10 @@ import (
 // ExchangeKey ..
 type ExchangeKey = exchange.Key
 
-// ByBit .. no SpecificParam.
-func New(key exchange.Key) (exchange.Exchange, error) {
-	return bybit.New(key)
+// Option .. optional setting of client. see bybit.WithXXX
+type Option = bybit.Option
+
+// ByBit .. SpecificParam: timeoutMS, recvWindowMS, baseURL, testnet. prefer bybit.WithXXX options.
+func New(key exchange.Key, opts ...Option) (exchange.ContextExchange, error) {
+	return bybit.New(key, opts...)
 }
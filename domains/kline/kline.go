@@ -0,0 +1,33 @@
+package kline
+
+import "time"
+
+// PriceType price source of kline.
+type PriceType int
+
+const (
+	// PriceTrade 約定価格
+	PriceTrade PriceType = iota
+	// PriceMark マーク価格
+	PriceMark
+	// PriceIndex インデックス価格
+	PriceIndex
+	// PricePremiumIndex プレミアムインデックス
+	PricePremiumIndex
+)
+
+// Kline candlestick of symbol.
+type Kline struct {
+	Symbol   string
+	Interval string
+	OpenTime time.Time
+	Open     float64
+	High     float64
+	Low      float64
+	Close    float64
+	// Volume, Turnover 約定価格のklineのみ
+	Volume   float64
+	Turnover float64
+	// Confirmed 足が確定していればtrue
+	Confirmed bool
+}
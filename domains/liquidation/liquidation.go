@@ -0,0 +1,16 @@
+package liquidation
+
+import (
+	"time"
+
+	"github.com/TTRSQ/bbwrapper/domains/base"
+)
+
+// Liquidation forced liquidation of someone's position.
+type Liquidation struct {
+	Symbol string
+	base.Norm
+	// IsBuy 清算注文の売買方向 (ショートの清算ならtrue)
+	IsBuy     bool
+	OccuredAt time.Time
+}
@@ -0,0 +1,58 @@
+package id
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Generator make client order id.
+type Generator interface {
+	Generate() string
+}
+
+// GeneratorFunc use function as Generator.
+type GeneratorFunc func() string
+
+// Generate call f.
+func (f GeneratorFunc) Generate() string {
+	return f()
+}
+
+// maxTagLength 取引所の上限(bybitは36文字)に収まるようにtagの長さを制限する
+const maxTagLength = 16
+
+// TagGenerator make "{tag}-{unix ms in base36}-{seq}" ids. tagで戦略毎の注文を見分ける
+type TagGenerator struct {
+	tag string
+	now func() time.Time
+
+	mu   sync.Mutex
+	last int64
+	seq  int
+}
+
+// NewTagGenerator return TagGenerator with strategy tag (e.g. "mm", "arb01").
+func NewTagGenerator(tag string) (*TagGenerator, error) {
+	if tag == "" || len(tag) > maxTagLength {
+		return nil, fmt.Errorf("id: tag must be 1 to %d characters: %q", maxTagLength, tag)
+	}
+	return &TagGenerator{tag: tag, now: time.Now}, nil
+}
+
+// Generate return unique id. 同じミリ秒内では連番で区別する
+func (g *TagGenerator) Generate() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	ms := g.now().UnixNano() / int64(time.Millisecond)
+	if ms <= g.last {
+		// 時計が戻っても重複しないよう前回の時刻を使い続ける
+		ms = g.last
+		g.seq++
+	} else {
+		g.last = ms
+		g.seq = 0
+	}
+	return g.tag + "-" + strconv.FormatInt(ms, 36) + "-" + strconv.Itoa(g.seq)
+}
@@ -0,0 +1,24 @@
+package id
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTagGenerator(t *testing.T) {
+	g, err := NewTagGenerator("mm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		v := g.Generate()
+		if seen[v] || !strings.HasPrefix(v, "mm-") || len(v) > 36 {
+			t.Fatalf("id = %s", v)
+		}
+		seen[v] = true
+	}
+	if _, err := NewTagGenerator(strings.Repeat("x", 17)); err == nil {
+		t.Error("too long tag must be error")
+	}
+}
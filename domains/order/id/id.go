@@ -7,6 +7,8 @@ type ID struct {
 	ExchangeName string
 	Symbol       string
 	LocalID      string
+	// ClientID 利用者が付けた注文id (bybitのorder_link_id). 付けていなければ空
+	ClientID string
 }
 
 // NewID .. make id obj.
@@ -18,6 +20,12 @@ func NewID(exchange, symbol, localID string) ID {
 	}
 }
 
+// WithClientID return copy of id with client order id.
+func (i ID) WithClientID(clientID string) ID {
+	i.ClientID = clientID
+	return i
+}
+
 // ToString return globalID with string.
 func (i *ID) ToString() string {
 	return fmt.Sprintf("%s::%s::%s", i.ExchangeName, i.Symbol, i.LocalID)
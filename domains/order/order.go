@@ -13,6 +13,42 @@ type Request struct {
 	OrderType string
 }
 
+// CreateRequest Request with execution options. 空の値は取引所のデフォルトになる
+type CreateRequest struct {
+	Request
+	// TimeInForce exchange.TimeInForcesの値
+	TimeInForce    string
+	ReduceOnly     bool
+	CloseOnTrigger bool
+	// OrderLinkID client order id. 指定するとタイムアウト時にも安全に再送できる
+	OrderLinkID string
+	// TakeProfit, StopLoss 約定後のポジションに設定する. 0なら設定しない
+	TakeProfit float64
+	StopLoss   float64
+	// TpTriggerBy, SlTriggerBy exchange.TriggerTypesの値
+	TpTriggerBy string
+	SlTriggerBy string
+}
+
+// ConditionalRequest stop order. 価格がStopPxに達するとCreateRequestが発注される
+type ConditionalRequest struct {
+	CreateRequest
+	// StopPx trigger price
+	StopPx float64
+	// BasePx 発注時点の価格. StopPxとの大小でトリガーの方向が決まる
+	BasePx float64
+	// TriggerBy exchange.TriggerTypesの値
+	TriggerBy string
+}
+
+// ConditionalOrder ConditionalOrderObj
+type ConditionalOrder struct {
+	id.ID
+	ConditionalRequest
+	Status        string
+	UpdatedAtUnix int
+}
+
 // Responce
 type Responce struct {
 	ID         id.ID
@@ -18,3 +18,17 @@ func (p *Position) HasLong() bool {
 func (p *Position) HasShort() bool {
 	return len(p.Short) != 0
 }
+
+// TradingStop take profit, stop loss and trailing stop of position.
+// nilの項目は変更せず、0を指定すると解除する
+type TradingStop struct {
+	Symbol       string
+	TakeProfit   *float64
+	StopLoss     *float64
+	TrailingStop *float64
+	// TpTriggerBy, SlTriggerBy exchange.TriggerTypesの値. 空なら取引所のデフォルト
+	TpTriggerBy string
+	SlTriggerBy string
+	// TrailingActive trailing stopが有効になる価格
+	TrailingActive *float64
+}
@@ -6,4 +6,8 @@ type Stock struct {
 	Summary   float64
 	LongSize  float64
 	ShortSize float64
+	// TakeProfit, StopLoss, TrailingStop ポジションに設定された値. 未設定なら0
+	TakeProfit   float64
+	StopLoss     float64
+	TrailingStop float64
 }
@@ -0,0 +1,19 @@
+package ticker
+
+import "time"
+
+// Ticker latest price, volume and funding information of symbol.
+type Ticker struct {
+	Symbol          string
+	LastPrice       float64
+	MarkPrice       float64
+	IndexPrice      float64
+	BestBid         float64
+	BestAsk         float64
+	Volume24h       float64
+	Turnover24h     float64
+	OpenInterest    float64
+	FundingRate     float64
+	NextFundingTime time.Time
+	UpdatedAt       time.Time
+}
@@ -2,4 +2,7 @@ module github.com/TTRSQ/bbwrapper
 
 go 1.15
 
-require github.com/golang-jwt/jwt/v4 v4.0.0
+require (
+	github.com/golang-jwt/jwt/v4 v4.0.0
+	github.com/gorilla/websocket v1.4.2
+)
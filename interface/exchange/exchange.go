@@ -1,11 +1,18 @@
 package exchange
 
 import (
+	"context"
+	"time"
+
 	"github.com/TTRSQ/bbwrapper/domains/base"
 	"github.com/TTRSQ/bbwrapper/domains/board"
 	"github.com/TTRSQ/bbwrapper/domains/execution"
+	"github.com/TTRSQ/bbwrapper/domains/kline"
+	"github.com/TTRSQ/bbwrapper/domains/liquidation"
 	"github.com/TTRSQ/bbwrapper/domains/order"
+	"github.com/TTRSQ/bbwrapper/domains/position"
 	"github.com/TTRSQ/bbwrapper/domains/stock"
+	"github.com/TTRSQ/bbwrapper/domains/ticker"
 )
 
 // Key .. key data for use private apis.
@@ -20,11 +27,32 @@ type OrderTypes struct {
 	Limit  string
 }
 
+type TimeInForces struct {
+	GoodTillCancel    string
+	ImmediateOrCancel string
+	FillOrKill        string
+	PostOnly          string
+}
+
+type TriggerTypes struct {
+	LastPrice  string
+	MarkPrice  string
+	IndexPrice string
+}
+
 type Symbols struct {
 	BtcJpy   string
 	FxBtcJpy string
 }
 
+// RateLimit remaining quota of endpoint group.
+type RateLimit struct {
+	Group     string
+	Remaining int
+	Limit     int
+	ResetAt   time.Time
+}
+
 // Exchange 取引所のラッパーentity
 type Exchange interface {
 	// const
@@ -51,9 +79,127 @@ type Exchange interface {
 	UpdateBestPrice(bestAsk, bestBid float64) error
 }
 
+// ContextExchange context対応版のExchange
+// ctxのキャンセル、デッドライン超過時はctx.Err()をラップしたエラーを返す
+type ContextExchange interface {
+	Exchange
+
+	// public
+	BoardsCtx(ctx context.Context, symbol string) (board.Board, error)
+
+	// private
+	CreateOrderCtx(ctx context.Context, price, size float64, isBuy bool, symbol, orderType string) (*order.Responce, error)
+	LiquidationOrderCtx(ctx context.Context, price, size float64, isBuy bool, symbol, orderType string) (*order.Responce, error)
+	EditOrderCtx(ctx context.Context, symbol, localID string, price, size float64) (*order.Order, error)
+	CancelOrderCtx(ctx context.Context, symbol, localID string) error
+	CancelAllOrderCtx(ctx context.Context, symbol string) error
+	ActiveOrdersCtx(ctx context.Context, symbol string) ([]order.Order, error)
+	StocksCtx(ctx context.Context, symbol string) (stock.Stock, error)
+	BalanceCtx(ctx context.Context) ([]base.Balance, error)
+	OpenInterestCtx(ctx context.Context, symbol string, minute, limit int) ([]base.OpenInterest, error)
+}
+
+// 以下は取引所によって対応していない機能. Exchange, ContextExchangeから型アサーションで使う
+// e.g. if rl, ok := ex.(exchange.RateLimitReporter); ok { ... }
+
+// RateLimitReporter 残りのレート制限を返す
+type RateLimitReporter interface {
+	RateLimitStatus() map[string]RateLimit
+}
+
+// ServerClock 取引所のサーバー時刻を返す
+type ServerClock interface {
+	ServerTime() (time.Time, error)
+	ServerTimeCtx(ctx context.Context) (time.Time, error)
+}
+
+// TickerProvider 最良気配、最終価格などを返す
+type TickerProvider interface {
+	Ticker(symbol string) (ticker.Ticker, error)
+	TickerCtx(ctx context.Context, symbol string) (ticker.Ticker, error)
+}
+
+// KlineProvider ローソク足を返す
+type KlineProvider interface {
+	Klines(symbol, interval string, from time.Time, limit int, priceType kline.PriceType) ([]kline.Kline, error)
+	KlinesCtx(ctx context.Context, symbol, interval string, from time.Time, limit int, priceType kline.PriceType) ([]kline.Kline, error)
+}
+
+// LiquidationProvider 清算履歴を返す
+type LiquidationProvider interface {
+	Liquidations(symbol string, from time.Time, limit int) ([]liquidation.Liquidation, error)
+	LiquidationsCtx(ctx context.Context, symbol string, from time.Time, limit int) ([]liquidation.Liquidation, error)
+}
+
+// OrderRequester time in force, reduce-only, TP/SLなどを指定した注文
+type OrderRequester interface {
+	TimeInForces() TimeInForces
+	CreateOrderByRequest(req order.CreateRequest) (*order.Responce, error)
+	CreateOrderByRequestCtx(ctx context.Context, req order.CreateRequest) (*order.Responce, error)
+}
+
+// ClientIDOrderer client order idで注文を操作する
+type ClientIDOrderer interface {
+	EditOrderByClientID(symbol, clientID string, price, size float64) (*order.Order, error)
+	EditOrderByClientIDCtx(ctx context.Context, symbol, clientID string, price, size float64) (*order.Order, error)
+	CancelOrderByClientID(symbol, clientID string) error
+	CancelOrderByClientIDCtx(ctx context.Context, symbol, clientID string) error
+	OrderByClientID(symbol, clientID string) (*order.Order, error)
+	OrderByClientIDCtx(ctx context.Context, symbol, clientID string) (*order.Order, error)
+}
+
+// ConditionalOrderer 逆指値(stop)注文
+// TriggerTypesはOrderRequester, TradingStopperのTP/SLでも使う
+type ConditionalOrderer interface {
+	TriggerTypes() TriggerTypes
+	CreateConditionalOrder(req order.ConditionalRequest) (*order.Responce, error)
+	CreateConditionalOrderCtx(ctx context.Context, req order.ConditionalRequest) (*order.Responce, error)
+	EditConditionalOrder(symbol, localID string, price, size, stopPx float64) (*order.ConditionalOrder, error)
+	EditConditionalOrderCtx(ctx context.Context, symbol, localID string, price, size, stopPx float64) (*order.ConditionalOrder, error)
+	CancelConditionalOrder(symbol, localID string) error
+	CancelConditionalOrderCtx(ctx context.Context, symbol, localID string) error
+	CancelAllConditionalOrder(symbol string) error
+	CancelAllConditionalOrderCtx(ctx context.Context, symbol string) error
+	ActiveConditionalOrders(symbol string) ([]order.ConditionalOrder, error)
+	ActiveConditionalOrdersCtx(ctx context.Context, symbol string) ([]order.ConditionalOrder, error)
+}
+
+// TradingStopper ポジションにTP/SL, trailing stopを設定する
+type TradingStopper interface {
+	SetTradingStop(ts position.TradingStop) error
+	SetTradingStopCtx(ctx context.Context, ts position.TradingStop) error
+}
+
+// StreamEventType kind of StreamEvent.
+type StreamEventType int
+
+const (
+	StreamConnected StreamEventType = iota
+	StreamDisconnected
+	StreamReconnected
+	// StreamGap 再接続などによりデータを取りこぼした可能性がある
+	StreamGap
+)
+
+// StreamEvent lifecycle event of Stream.
+type StreamEvent struct {
+	Type StreamEventType
+	At   time.Time
+	// Err 切断理由
+	Err error
+}
+
 // Stream socketを起動し受け取る
 type Stream interface {
 	Start() error
 	// Read Execution, error Executionはなかったらnilが飛ぶ
 	Read() (execution.Execution, error)
 }
+
+// LifecycleStream 接続状態の通知と終了に対応したStream
+type LifecycleStream interface {
+	Stream
+	// Events 接続状態の変化を通知する。Stream終了時にcloseされる
+	Events() <-chan StreamEvent
+	Close() error
+}
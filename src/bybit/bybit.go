@@ -2,6 +2,7 @@ package bybit
 
 import (
 	"bytes"
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/json"
@@ -9,13 +10,12 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
 	"math"
 	"net/http"
 	"net/url"
 	"reflect"
 	"sort"
-	"strconv"
+	"strings"
 	"time"
 
 	"github.com/TTRSQ/bbwrapper/domains/base"
@@ -27,17 +27,42 @@ import (
 )
 
 type bybit struct {
-	name       string
-	host       string
-	key        exchange.Key
-	httpClient *http.Client
+	name        string
+	baseURL     *url.URL
+	key         exchange.Key
+	httpClient  *http.Client
+	timeout     time.Duration
+	transport   http.RoundTripper
+	middlewares []Middleware
+	recvWindow  time.Duration
+	now         func() time.Time
+	clock       *clockSync
+	rateLimiter *rateLimiter
+	retryPolicy RetryPolicy
+	logger      Logger
+	clientIDs   id.Generator
+	// closeOnTrigger LiquidationOrderにclose_on_triggerを付ける
+	closeOnTrigger bool
 }
 
+// bybitが対応している追加機能
+var (
+	_ exchange.RateLimitReporter   = (*bybit)(nil)
+	_ exchange.ServerClock         = (*bybit)(nil)
+	_ exchange.TickerProvider      = (*bybit)(nil)
+	_ exchange.KlineProvider       = (*bybit)(nil)
+	_ exchange.LiquidationProvider = (*bybit)(nil)
+	_ exchange.OrderRequester      = (*bybit)(nil)
+	_ exchange.ClientIDOrderer     = (*bybit)(nil)
+	_ exchange.ConditionalOrderer  = (*bybit)(nil)
+	_ exchange.TradingStopper      = (*bybit)(nil)
+)
+
 // New return exchange obj.
-func New(key exchange.Key) (exchange.Exchange, error) {
+func New(key exchange.Key, opts ...Option) (exchange.ContextExchange, error) {
 	bb := bybit{}
 	bb.name = "bybit"
-	bb.host = "api.bybit.com"
+	bb.baseURL, _ = parseBaseURL(restURLs[Mainnet])
 
 	if key.APIKey == "" || key.APISecKey == "" {
 		return nil, errors.New("APIKey and APISecKey Required")
@@ -45,9 +70,24 @@ func New(key exchange.Key) (exchange.Exchange, error) {
 	bb.key = key
 
 	bb.httpClient = new(http.Client)
-	if key.SpecificParam["timeoutMS"] != nil {
-		bb.httpClient.Timeout = time.Duration(key.SpecificParam["timeoutMS"].(int)) * time.Millisecond
+	bb.now = time.Now
+	bb.clock = &clockSync{}
+	bb.logger = nopLogger{}
+	bb.rateLimiter = newRateLimiter()
+
+	// SpecificParamを先に適用し、引数のoptionで上書きする
+	paramOpts, err := specificParamOptions(key.SpecificParam)
+	if err != nil {
+		return nil, err
 	}
+	for _, opt := range append(paramOpts, opts...) {
+		if err := opt(&bb); err != nil {
+			return nil, err
+		}
+	}
+
+	bb.buildHTTPClient()
+	bb.rateLimiter.now = bb.now
 
 	return &bb, nil
 }
@@ -63,25 +103,114 @@ func (bb *bybit) OrderTypes() exchange.OrderTypes {
 	}
 }
 
+func (bb *bybit) TimeInForces() exchange.TimeInForces {
+	return exchange.TimeInForces{
+		GoodTillCancel:    "GoodTillCancel",
+		ImmediateOrCancel: "ImmediateOrCancel",
+		FillOrKill:        "FillOrKill",
+		PostOnly:          "PostOnly",
+	}
+}
+
 func (bb *bybit) CreateOrder(price, size float64, isBuy bool, symbol, orderType string) (*order.Responce, error) {
+	return bb.CreateOrderCtx(context.Background(), price, size, isBuy, symbol, orderType)
+}
+
+func (bb *bybit) CreateOrderCtx(ctx context.Context, price, size float64, isBuy bool, symbol, orderType string) (*order.Responce, error) {
+	return bb.CreateOrderByRequestCtx(ctx, order.CreateRequest{
+		Request: order.Request{
+			Norm:      base.Norm{Price: price, Size: size},
+			Symbol:    symbol,
+			IsBuy:     isBuy,
+			OrderType: orderType,
+		},
+		TimeInForce: bb.TimeInForces().GoodTillCancel,
+	})
+}
+
+func (bb *bybit) CreateOrderByRequest(req order.CreateRequest) (*order.Responce, error) {
+	return bb.CreateOrderByRequestCtx(context.Background(), req)
+}
+
+// validateCreateRequest 送る前に分かる誤りを弾く. TimeInForceが空ならGoodTillCancel
+func (bb *bybit) validateCreateRequest(req *order.CreateRequest) error {
+	types, tifs := bb.OrderTypes(), bb.TimeInForces()
+	if req.OrderType != types.Limit && req.OrderType != types.Market {
+		return fmt.Errorf("bybit: unknown order type %q", req.OrderType)
+	}
+	if req.Size <= 0 {
+		return fmt.Errorf("bybit: order size must be positive: %v", req.Size)
+	}
+	switch req.TimeInForce {
+	case "":
+		req.TimeInForce = tifs.GoodTillCancel
+	case tifs.GoodTillCancel, tifs.ImmediateOrCancel, tifs.FillOrKill:
+	case tifs.PostOnly:
+		if req.OrderType != types.Limit {
+			return errors.New("bybit: PostOnly is only for limit order")
+		}
+	default:
+		return fmt.Errorf("bybit: unknown time in force %q", req.TimeInForce)
+	}
+	if req.TakeProfit < 0 || req.StopLoss < 0 {
+		return fmt.Errorf("bybit: take profit and stop loss must not be negative: %v, %v", req.TakeProfit, req.StopLoss)
+	}
+	if err := bb.checkTriggerBy(req.TpTriggerBy); err != nil {
+		return err
+	}
+	return bb.checkTriggerBy(req.SlTriggerBy)
+}
+
+func (bb *bybit) CreateOrderByRequestCtx(ctx context.Context, req order.CreateRequest) (*order.Responce, error) {
+	if err := bb.validateCreateRequest(&req); err != nil {
+		return nil, err
+	}
+	if req.OrderLinkID == "" && bb.clientIDs != nil {
+		req.OrderLinkID = bb.clientIDs.Generate()
+	}
+	price, size, symbol := req.Price, req.Size, req.Symbol
+
 	type Req struct {
-		Side        string  `json:"side"`
-		Symbol      string  `json:"symbol"`
-		OrderType   string  `json:"order_type"`
-		Qty         float64 `json:"qty"`
-		Price       float64 `json:"price"`
-		TimeInForce string  `json:"time_in_force"`
+		Side           string  `json:"side"`
+		Symbol         string  `json:"symbol"`
+		OrderType      string  `json:"order_type"`
+		Qty            float64 `json:"qty"`
+		Price          float64 `json:"price"`
+		TimeInForce    string  `json:"time_in_force"`
+		ReduceOnly     bool    `json:"reduce_only,omitempty"`
+		CloseOnTrigger bool    `json:"close_on_trigger,omitempty"`
+		OrderLinkID    string  `json:"order_link_id,omitempty"`
+		TakeProfit     float64 `json:"take_profit,omitempty"`
+		StopLoss       float64 `json:"stop_loss,omitempty"`
+		TpTriggerBy    string  `json:"tp_trigger_by,omitempty"`
+		SlTriggerBy    string  `json:"sl_trigger_by,omitempty"`
 	}
 
-	res, err := bb.postRequest("/v2/private/order/create", structToMap(&Req{
-		Symbol:      symbol,
-		OrderType:   orderType,
-		Side:        map[bool]string{true: "Buy", false: "Sell"}[isBuy],
-		Price:       map[bool]float64{true: price, false: 0}[orderType == bb.OrderTypes().Limit],
-		Qty:         size,
-		TimeInForce: "GoodTillCancel",
+	res, err := bb.postRequest(ctx, "/v2/private/order/create", structToMap(&Req{
+		Symbol:         symbol,
+		OrderType:      req.OrderType,
+		Side:           map[bool]string{true: "Buy", false: "Sell"}[req.IsBuy],
+		Price:          map[bool]float64{true: price, false: 0}[req.OrderType == bb.OrderTypes().Limit],
+		Qty:            size,
+		TimeInForce:    req.TimeInForce,
+		ReduceOnly:     req.ReduceOnly,
+		CloseOnTrigger: req.CloseOnTrigger,
+		OrderLinkID:    req.OrderLinkID,
+		TakeProfit:     req.TakeProfit,
+		StopLoss:       req.StopLoss,
+		TpTriggerBy:    req.TpTriggerBy,
+		SlTriggerBy:    req.SlTriggerBy,
 	}))
 
+	// 再送した注文が重複で弾かれた場合は前の試行で作られた注文を返す
+	var created *createdByEarlierAttempt
+	if errors.As(err, &created) {
+		o, filled, err := bb.orderByClientID(ctx, symbol, req.OrderLinkID)
+		if err != nil {
+			return nil, fmt.Errorf("bybit: look up order %s created by earlier attempt: %w", req.OrderLinkID, err)
+		}
+		return &order.Responce{ID: o.ID, FilledSize: filled}, nil
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -98,16 +227,16 @@ func (bb *bybit) CreateOrder(price, size float64, isBuy bool, symbol, orderType
 			Symbol        string    `json:"symbol"`
 			Side          string    `json:"side"`
 			OrderType     string    `json:"order_type"`
-			Price         int       `json:"price"`
-			Qty           int       `json:"qty"`
+			Price         number    `json:"price"`
+			Qty           number    `json:"qty"`
 			TimeInForce   string    `json:"time_in_force"`
 			OrderStatus   string    `json:"order_status"`
-			LastExecTime  int       `json:"last_exec_time"`
-			LastExecPrice int       `json:"last_exec_price"`
-			LeavesQty     int       `json:"leaves_qty"`
-			CumExecQty    int       `json:"cum_exec_qty"`
-			CumExecValue  int       `json:"cum_exec_value"`
-			CumExecFee    int       `json:"cum_exec_fee"`
+			LastExecTime  number    `json:"last_exec_time"`
+			LastExecPrice number    `json:"last_exec_price"`
+			LeavesQty     number    `json:"leaves_qty"`
+			CumExecQty    number    `json:"cum_exec_qty"`
+			CumExecValue  number    `json:"cum_exec_value"`
+			CumExecFee    number    `json:"cum_exec_fee"`
 			RejectReason  string    `json:"reject_reason"`
 			OrderLinkID   string    `json:"order_link_id"`
 			CreatedAt     time.Time `json:"created_at"`
@@ -120,26 +249,107 @@ func (bb *bybit) CreateOrder(price, size float64, isBuy bool, symbol, orderType
 	}
 
 	resData := Res{}
-	json.Unmarshal(res, &resData)
+	if err := decode("/v2/private/order/create", res, &resData); err != nil {
+		return nil, err
+	}
 
 	return &order.Responce{
-		ID:         id.NewID(bb.name, symbol, fmt.Sprint(resData.Result.OrderID)),
+		ID:         id.NewID(bb.name, symbol, resData.Result.OrderID).WithClientID(req.OrderLinkID),
 		FilledSize: size - float64(resData.Result.LeavesQty),
 	}, nil
 }
 
 func (bb *bybit) LiquidationOrder(price, size float64, isBuy bool, symbol, orderType string) (*order.Responce, error) {
-	return nil, errors.New("LiquidationOrder not supported.")
+	return bb.LiquidationOrderCtx(context.Background(), price, size, isBuy, symbol, orderType)
+}
+
+// LiquidationOrderCtx ポジションを減らす方向のreduce-only注文.
+// sizeはポジションから既存のreduce-only注文の残りを引いた分を超えないよう切り詰める
+func (bb *bybit) LiquidationOrderCtx(ctx context.Context, price, size float64, isBuy bool, symbol, orderType string) (*order.Responce, error) {
+	st, err := bb.StocksCtx(ctx, symbol)
+	if err != nil {
+		return nil, err
+	}
+	// 買いはショート、売りはロングしか減らせない
+	held := map[bool]float64{true: st.ShortSize, false: st.LongSize}[isBuy]
+	// 既に出ているreduce-only注文の分は決済済みとみなす
+	resting, err := bb.restingReduceOnlySize(ctx, symbol, isBuy)
+	if err != nil {
+		return nil, err
+	}
+	held -= resting
+	if held <= 0 {
+		return nil, fmt.Errorf("bybit: no position of %s to close by %s: %w", symbol, map[bool]string{true: "Buy", false: "Sell"}[isBuy], ErrReduceOnly)
+	}
+	if size > held {
+		size = held
+	}
+
+	return bb.CreateOrderByRequestCtx(ctx, order.CreateRequest{
+		Request: order.Request{
+			Norm:      base.Norm{Price: price, Size: size},
+			Symbol:    symbol,
+			IsBuy:     isBuy,
+			OrderType: orderType,
+		},
+		ReduceOnly:     true,
+		CloseOnTrigger: bb.closeOnTrigger,
+	})
+}
+
+// restingReduceOnlySize return unfilled size of active reduce-only orders of the side.
+func (bb *bybit) restingReduceOnlySize(ctx context.Context, symbol string, isBuy bool) (float64, error) {
+	type Req struct {
+		Symbol string `json:"symbol"`
+	}
+	res, err := bb.getRequest(ctx, "/v2/private/order", structToMap(&Req{
+		Symbol: symbol,
+	}))
+	if err != nil {
+		return 0, err
+	}
+	// order_id, order_link_idを指定しなければ有効な注文が配列で返る. reduce_onlyはext_fieldsにしかない
+	type Res struct {
+		RetCode int    `json:"ret_code"`
+		RetMsg  string `json:"ret_msg"`
+		ExtCode string `json:"ext_code"`
+		ExtInfo string `json:"ext_info"`
+		Result  []struct {
+			Side      string `json:"side"`
+			LeavesQty number `json:"leaves_qty"`
+			ExtFields struct {
+				ReduceOnly bool `json:"reduce_only"`
+			} `json:"ext_fields"`
+		} `json:"result"`
+		TimeNow string `json:"time_now"`
+	}
+	resData := Res{}
+	if err := decode("/v2/private/order", res, &resData); err != nil {
+		return 0, err
+	}
+
+	side := map[bool]string{true: "Buy", false: "Sell"}[isBuy]
+	resting := 0.0
+	for _, v := range resData.Result {
+		if v.Side == side && v.ExtFields.ReduceOnly {
+			resting += float64(v.LeavesQty)
+		}
+	}
+	return resting, nil
 }
 
 func (bb *bybit) OpenInterest(symbol string, minute, limit int) ([]base.OpenInterest, error) {
+	return bb.OpenInterestCtx(context.Background(), symbol, minute, limit)
+}
+
+func (bb *bybit) OpenInterestCtx(ctx context.Context, symbol string, minute, limit int) ([]base.OpenInterest, error) {
 	// リクエスト
 	type Req struct {
 		Symbol string `json:"symbol"`
 		Period string `json:"period"`
 		Limit  string `json:"limit"`
 	}
-	res, err := bb.getRequest("/v2/public/open-interest", structToMap(&Req{
+	res, err := bb.getRequest(ctx, "/v2/public/open-interest", structToMap(&Req{
 		Symbol: symbol,
 		Period: fmt.Sprint(minute) + "min",
 		Limit:  fmt.Sprint(limit),
@@ -155,24 +365,23 @@ func (bb *bybit) OpenInterest(symbol string, minute, limit int) ([]base.OpenInte
 		ExtCode string `json:"ext_code"`
 		ExtInfo string `json:"ext_info"`
 		Result  []struct {
-			OpenInterest int    `json:"open_interest"`
-			Timestamp    int    `json:"timestamp"`
+			OpenInterest number `json:"open_interest"`
+			Timestamp    number `json:"timestamp"`
 			Symbol       string `json:"symbol"`
 		} `json:"result"`
 		TimeNow string `json:"time_now"`
 	}
 	resData := Res{}
-	json.Unmarshal(res, &resData)
-	if resData.RetMsg != "OK" {
-		return []base.OpenInterest{}, errors.New(resData.RetMsg + ":" + resData.ExtCode)
+	if err := decode("/v2/public/open-interest", res, &resData); err != nil {
+		return []base.OpenInterest{}, err
 	}
 
 	ret := []base.OpenInterest{}
 	for i := range resData.Result {
 		item := resData.Result[i]
 		ret = append(ret, base.OpenInterest{
-			OpenInterest: item.OpenInterest,
-			Timestamp:    item.Timestamp,
+			OpenInterest: int(item.OpenInterest),
+			Timestamp:    int(item.Timestamp),
 		})
 	}
 
@@ -180,18 +389,37 @@ func (bb *bybit) OpenInterest(symbol string, minute, limit int) ([]base.OpenInte
 }
 
 func (bb *bybit) EditOrder(symbol, localID string, price, size float64) (*order.Order, error) {
+	return bb.EditOrderCtx(context.Background(), symbol, localID, price, size)
+}
+
+func (bb *bybit) EditOrderCtx(ctx context.Context, symbol, localID string, price, size float64) (*order.Order, error) {
+	return bb.editOrder(ctx, symbol, localID, "", price, size)
+}
+
+func (bb *bybit) EditOrderByClientID(symbol, clientID string, price, size float64) (*order.Order, error) {
+	return bb.EditOrderByClientIDCtx(context.Background(), symbol, clientID, price, size)
+}
+
+func (bb *bybit) EditOrderByClientIDCtx(ctx context.Context, symbol, clientID string, price, size float64) (*order.Order, error) {
+	return bb.editOrder(ctx, symbol, "", clientID, price, size)
+}
+
+// editOrder order_idかorder_link_idのどちらかで注文を指定する
+func (bb *bybit) editOrder(ctx context.Context, symbol, localID, clientID string, price, size float64) (*order.Order, error) {
 	// リクエスト
 	type Req struct {
-		OrderID string `json:"order_id"`
-		Symbol  string `json:"symbol"`
-		Qty     string `json:"p_r_qty"`
-		Price   string `json:"p_r_price"`
-	}
-	res, err := bb.postRequest("/v2/private/order/replace", structToMap(&Req{
-		OrderID: localID,
-		Symbol:  symbol,
-		Qty:     fmt.Sprint(size),
-		Price:   fmt.Sprint(price),
+		OrderID     string `json:"order_id,omitempty"`
+		OrderLinkID string `json:"order_link_id,omitempty"`
+		Symbol      string `json:"symbol"`
+		Qty         string `json:"p_r_qty"`
+		Price       string `json:"p_r_price"`
+	}
+	res, err := bb.postRequest(ctx, "/v2/private/order/replace", structToMap(&Req{
+		OrderID:     localID,
+		OrderLinkID: clientID,
+		Symbol:      symbol,
+		Qty:         fmt.Sprint(size),
+		Price:       fmt.Sprint(price),
 	}))
 	if err != nil {
 		return nil, err
@@ -205,28 +433,44 @@ func (bb *bybit) EditOrder(symbol, localID string, price, size float64) (*order.
 		Result  struct {
 			OrderID string `json:"order_id"`
 		} `json:"result"`
-		TimeNow          string `json:"time_now"`
+		TimeNow          number `json:"time_now"`
 		RateLimitStatus  int    `json:"rate_limit_status"`
 		RateLimitResetMs int64  `json:"rate_limit_reset_ms"`
 		RateLimit        int    `json:"rate_limit"`
 	}
 	resData := Res{}
-	json.Unmarshal(res, &resData)
-	if resData.RetMsg != "OK" {
-		return nil, errors.New(resData.RetMsg + ":" + resData.ExtCode)
+	if err := decode("/v2/private/order/replace", res, &resData); err != nil {
+		return nil, err
 	}
-	t, _ := strconv.ParseFloat(resData.TimeNow, 64)
 	return &order.Order{
-		ID:            id.NewID(bb.name, symbol, resData.Result.OrderID),
+		ID:            id.NewID(bb.name, symbol, resData.Result.OrderID).WithClientID(clientID),
 		Request:       order.Request{},
-		UpdatedAtUnix: int(t),
+		UpdatedAtUnix: int(resData.TimeNow),
 	}, nil
 }
 
 func (bb *bybit) CancelOrder(symbol, localID string) error {
+	return bb.CancelOrderCtx(context.Background(), symbol, localID)
+}
+
+func (bb *bybit) CancelOrderCtx(ctx context.Context, symbol, localID string) error {
+	return bb.cancelOrder(ctx, symbol, localID, "")
+}
+
+func (bb *bybit) CancelOrderByClientID(symbol, clientID string) error {
+	return bb.CancelOrderByClientIDCtx(context.Background(), symbol, clientID)
+}
+
+func (bb *bybit) CancelOrderByClientIDCtx(ctx context.Context, symbol, clientID string) error {
+	return bb.cancelOrder(ctx, symbol, "", clientID)
+}
+
+// cancelOrder order_idかorder_link_idのどちらかで注文を指定する
+func (bb *bybit) cancelOrder(ctx context.Context, symbol, localID, clientID string) error {
 	type Req struct {
-		Symbol  string `json:"symbol"`
-		OrderID string `json:"order_id"`
+		Symbol      string `json:"symbol"`
+		OrderID     string `json:"order_id,omitempty"`
+		OrderLinkID string `json:"order_link_id,omitempty"`
 	}
 
 	type Res struct {
@@ -240,16 +484,16 @@ func (bb *bybit) CancelOrder(symbol, localID string) error {
 			Symbol        string    `json:"symbol"`
 			Side          string    `json:"side"`
 			OrderType     string    `json:"order_type"`
-			Price         int       `json:"price"`
-			Qty           int       `json:"qty"`
+			Price         number    `json:"price"`
+			Qty           number    `json:"qty"`
 			TimeInForce   string    `json:"time_in_force"`
 			OrderStatus   string    `json:"order_status"`
-			LastExecTime  int       `json:"last_exec_time"`
-			LastExecPrice int       `json:"last_exec_price"`
-			LeavesQty     int       `json:"leaves_qty"`
-			CumExecQty    int       `json:"cum_exec_qty"`
-			CumExecValue  int       `json:"cum_exec_value"`
-			CumExecFee    int       `json:"cum_exec_fee"`
+			LastExecTime  number    `json:"last_exec_time"`
+			LastExecPrice number    `json:"last_exec_price"`
+			LeavesQty     number    `json:"leaves_qty"`
+			CumExecQty    number    `json:"cum_exec_qty"`
+			CumExecValue  number    `json:"cum_exec_value"`
+			CumExecFee    number    `json:"cum_exec_fee"`
 			RejectReason  string    `json:"reject_reason"`
 			OrderLinkID   string    `json:"order_link_id"`
 			CreatedAt     time.Time `json:"created_at"`
@@ -260,26 +504,29 @@ func (bb *bybit) CancelOrder(symbol, localID string) error {
 		RateLimitResetMs int64  `json:"rate_limit_reset_ms"`
 		RateLimit        int    `json:"rate_limit"`
 	}
-	res, err := bb.postRequest("/v2/private/order/cancel", structToMap(&Req{
-		Symbol:  symbol,
-		OrderID: localID,
+	res, err := bb.postRequest(ctx, "/v2/private/order/cancel", structToMap(&Req{
+		Symbol:      symbol,
+		OrderID:     localID,
+		OrderLinkID: clientID,
 	}))
 	if err != nil {
 		return err
 	}
 
 	resData := Res{}
-	json.Unmarshal(res, &resData)
-
-	return nil
+	return decode("/v2/private/order/cancel", res, &resData)
 }
 
 func (bb *bybit) CancelAllOrder(symbol string) error {
+	return bb.CancelAllOrderCtx(context.Background(), symbol)
+}
+
+func (bb *bybit) CancelAllOrderCtx(ctx context.Context, symbol string) error {
 	type Req struct {
 		Symbol string `json:"symbol"`
 	}
 
-	_, err := bb.postRequest("/v2/private/order/cancelAll", structToMap(&Req{
+	_, err := bb.postRequest(ctx, "/v2/private/order/cancelAll", structToMap(&Req{
 		Symbol: symbol,
 	}))
 
@@ -287,11 +534,15 @@ func (bb *bybit) CancelAllOrder(symbol string) error {
 }
 
 func (bb *bybit) ActiveOrders(symbol string) ([]order.Order, error) {
+	return bb.ActiveOrdersCtx(context.Background(), symbol)
+}
+
+func (bb *bybit) ActiveOrdersCtx(ctx context.Context, symbol string) ([]order.Order, error) {
 	type Req struct {
 		Symbol      string `json:"symbol"`
 		OrderStatus string `json:"order_status"`
 	}
-	res, err := bb.getRequest("/v2/private/order/list", structToMap(&Req{
+	res, err := bb.getRequest(ctx, "/v2/private/order/list", structToMap(&Req{
 		Symbol:      symbol,
 		OrderStatus: "Created,New,PartiallyFilled", // 今後の取引に関わるもののみ
 	}))
@@ -310,18 +561,18 @@ func (bb *bybit) ActiveOrders(symbol string) ([]order.Order, error) {
 				Symbol       string    `json:"symbol"`
 				Side         string    `json:"side"`
 				OrderType    string    `json:"order_type"`
-				Price        string    `json:"price"`
-				Qty          string    `json:"qty"`
+				Price        number    `json:"price"`
+				Qty          number    `json:"qty"`
 				TimeInForce  string    `json:"time_in_force"`
 				OrderLinkID  string    `json:"order_link_id"`
 				OrderID      string    `json:"order_id"`
 				CreatedAt    time.Time `json:"created_at"`
 				UpdatedAt    time.Time `json:"updated_at"`
-				LeavesQty    string    `json:"leaves_qty"`
-				LeavesValue  string    `json:"leaves_value"`
-				CumExecQty   string    `json:"cum_exec_qty"`
-				CumExecValue string    `json:"cum_exec_value"`
-				CumExecFee   string    `json:"cum_exec_fee"`
+				LeavesQty    number    `json:"leaves_qty"`
+				LeavesValue  number    `json:"leaves_value"`
+				CumExecQty   number    `json:"cum_exec_qty"`
+				CumExecValue number    `json:"cum_exec_value"`
+				CumExecFee   number    `json:"cum_exec_fee"`
 				RejectReason string    `json:"reject_reason"`
 			} `json:"data"`
 			Cursor string `json:"cursor"`
@@ -332,18 +583,18 @@ func (bb *bybit) ActiveOrders(symbol string) ([]order.Order, error) {
 		RateLimit        int    `json:"rate_limit"`
 	}
 	resData := Res{}
-	json.Unmarshal(res, &resData)
+	if err := decode("/v2/private/order/list", res, &resData); err != nil {
+		return []order.Order{}, err
+	}
 
 	orders := []order.Order{}
 	for _, v := range resData.Result.Data {
-		price, _ := strconv.ParseFloat(v.Price, 64)
-		size, _ := strconv.ParseFloat(v.Side, 64)
 		orders = append(orders, order.Order{
-			ID: id.NewID(bb.name, symbol, v.OrderID),
+			ID: id.NewID(bb.name, symbol, v.OrderID).WithClientID(v.OrderLinkID),
 			Request: order.Request{
 				Norm: base.Norm{
-					Price: price,
-					Size:  size,
+					Price: float64(v.Price),
+					Size:  float64(v.Qty),
 				},
 				Symbol:    symbol,
 				IsBuy:     v.Side == "Buy",
@@ -356,11 +607,86 @@ func (bb *bybit) ActiveOrders(symbol string) ([]order.Order, error) {
 	return orders, nil
 }
 
+func (bb *bybit) OrderByClientID(symbol, clientID string) (*order.Order, error) {
+	return bb.OrderByClientIDCtx(context.Background(), symbol, clientID)
+}
+
+func (bb *bybit) OrderByClientIDCtx(ctx context.Context, symbol, clientID string) (*order.Order, error) {
+	o, _, err := bb.orderByClientID(ctx, symbol, clientID)
+	return o, err
+}
+
+// orderByClientID return order and its filled size.
+func (bb *bybit) orderByClientID(ctx context.Context, symbol, clientID string) (*order.Order, float64, error) {
+	type Req struct {
+		Symbol      string `json:"symbol"`
+		OrderLinkID string `json:"order_link_id"`
+	}
+	res, err := bb.getRequest(ctx, "/v2/private/order", structToMap(&Req{
+		Symbol:      symbol,
+		OrderLinkID: clientID,
+	}))
+	if err != nil {
+		return nil, 0, err
+	}
+	// order_link_idを指定するとresultは配列ではなく1件のobjectになる
+	type Res struct {
+		RetCode int    `json:"ret_code"`
+		RetMsg  string `json:"ret_msg"`
+		ExtCode string `json:"ext_code"`
+		ExtInfo string `json:"ext_info"`
+		Result  *struct {
+			UserID       int       `json:"user_id"`
+			Symbol       string    `json:"symbol"`
+			Side         string    `json:"side"`
+			OrderType    string    `json:"order_type"`
+			Price        number    `json:"price"`
+			Qty          number    `json:"qty"`
+			TimeInForce  string    `json:"time_in_force"`
+			OrderStatus  string    `json:"order_status"`
+			LeavesQty    number    `json:"leaves_qty"`
+			CumExecQty   number    `json:"cum_exec_qty"`
+			RejectReason string    `json:"reject_reason"`
+			OrderLinkID  string    `json:"order_link_id"`
+			OrderID      string    `json:"order_id"`
+			CreatedAt    time.Time `json:"created_at"`
+			UpdatedAt    time.Time `json:"updated_at"`
+		} `json:"result"`
+		TimeNow string `json:"time_now"`
+	}
+	resData := Res{}
+	if err := decode("/v2/private/order", res, &resData); err != nil {
+		return nil, 0, err
+	}
+	if resData.Result == nil || resData.Result.OrderID == "" {
+		return nil, 0, fmt.Errorf("bybit: order %s: %w", clientID, ErrOrderNotFound)
+	}
+
+	v := resData.Result
+	return &order.Order{
+		ID: id.NewID(bb.name, symbol, v.OrderID).WithClientID(v.OrderLinkID),
+		Request: order.Request{
+			Norm: base.Norm{
+				Price: float64(v.Price),
+				Size:  float64(v.Qty),
+			},
+			Symbol:    symbol,
+			IsBuy:     v.Side == "Buy",
+			OrderType: v.OrderType,
+		},
+		UpdatedAtUnix: int(v.UpdatedAt.Unix()),
+	}, float64(v.CumExecQty), nil
+}
+
 func (bb *bybit) Stocks(symbol string) (stock.Stock, error) {
+	return bb.StocksCtx(context.Background(), symbol)
+}
+
+func (bb *bybit) StocksCtx(ctx context.Context, symbol string) (stock.Stock, error) {
 	type Req struct {
 		Symbol string `json:"symbol"`
 	}
-	res, err := bb.getRequest("/v2/private/position/list", structToMap(&Req{
+	res, err := bb.getRequest(ctx, "/v2/private/position/list", structToMap(&Req{
 		Symbol: symbol,
 	}))
 	if err != nil {
@@ -378,29 +704,29 @@ func (bb *bybit) Stocks(symbol string) (stock.Stock, error) {
 			RiskID              int       `json:"risk_id"`
 			Symbol              string    `json:"symbol"`
 			Side                string    `json:"side"`
-			Size                float64   `json:"size"`
-			PositionValue       string    `json:"position_value"`
-			EntryPrice          string    `json:"entry_price"`
+			Size                number    `json:"size"`
+			PositionValue       number    `json:"position_value"`
+			EntryPrice          number    `json:"entry_price"`
 			IsIsolated          bool      `json:"is_isolated"`
 			AutoAddMargin       int       `json:"auto_add_margin"`
-			Leverage            string    `json:"leverage"`
-			EffectiveLeverage   string    `json:"effective_leverage"`
-			PositionMargin      string    `json:"position_margin"`
-			LiqPrice            string    `json:"liq_price"`
-			BustPrice           string    `json:"bust_price"`
-			OccClosingFee       string    `json:"occ_closing_fee"`
-			OccFundingFee       string    `json:"occ_funding_fee"`
-			TakeProfit          string    `json:"take_profit"`
-			StopLoss            string    `json:"stop_loss"`
-			TrailingStop        string    `json:"trailing_stop"`
+			Leverage            number    `json:"leverage"`
+			EffectiveLeverage   number    `json:"effective_leverage"`
+			PositionMargin      number    `json:"position_margin"`
+			LiqPrice            number    `json:"liq_price"`
+			BustPrice           number    `json:"bust_price"`
+			OccClosingFee       number    `json:"occ_closing_fee"`
+			OccFundingFee       number    `json:"occ_funding_fee"`
+			TakeProfit          number    `json:"take_profit"`
+			StopLoss            number    `json:"stop_loss"`
+			TrailingStop        number    `json:"trailing_stop"`
 			PositionStatus      string    `json:"position_status"`
 			DeleverageIndicator int       `json:"deleverage_indicator"`
 			OcCalcData          string    `json:"oc_calc_data"`
-			OrderMargin         string    `json:"order_margin"`
-			WalletBalance       string    `json:"wallet_balance"`
-			RealisedPnl         string    `json:"realised_pnl"`
-			UnrealisedPnl       int       `json:"unrealised_pnl"`
-			CumRealisedPnl      string    `json:"cum_realised_pnl"`
+			OrderMargin         number    `json:"order_margin"`
+			WalletBalance       number    `json:"wallet_balance"`
+			RealisedPnl         number    `json:"realised_pnl"`
+			UnrealisedPnl       number    `json:"unrealised_pnl"`
+			CumRealisedPnl      number    `json:"cum_realised_pnl"`
 			CrossSeq            int       `json:"cross_seq"`
 			PositionSeq         int       `json:"position_seq"`
 			CreatedAt           time.Time `json:"created_at"`
@@ -412,15 +738,23 @@ func (bb *bybit) Stocks(symbol string) (stock.Stock, error) {
 		RateLimit        int    `json:"rate_limit"`
 	}
 	resData := Res{}
-	json.Unmarshal(res, &resData)
+	if err := decode("/v2/private/position/list", res, &resData); err != nil {
+		return stock.Stock{}, err
+	}
 
-	size := resData.Result.Size
+	size := float64(resData.Result.Size)
 	sizeAbs := math.Abs(size)
 	if resData.Result.Side == "Sell" {
 		size *= -1
 	}
 
-	stock := stock.Stock{Symbol: symbol, Summary: size}
+	stock := stock.Stock{
+		Symbol:       symbol,
+		Summary:      size,
+		TakeProfit:   float64(resData.Result.TakeProfit),
+		StopLoss:     float64(resData.Result.StopLoss),
+		TrailingStop: float64(resData.Result.TrailingStop),
+	}
 	if size > 0 {
 		stock.LongSize = sizeAbs
 	} else {
@@ -431,7 +765,11 @@ func (bb *bybit) Stocks(symbol string) (stock.Stock, error) {
 }
 
 func (bb *bybit) Balance() ([]base.Balance, error) {
-	res, err := bb.getRequest("/v2/private/wallet/balance", map[string]string{})
+	return bb.BalanceCtx(context.Background())
+}
+
+func (bb *bybit) BalanceCtx(ctx context.Context) ([]base.Balance, error) {
+	res, err := bb.getRequest(ctx, "/v2/private/wallet/balance", map[string]string{})
 	if err != nil {
 		return []base.Balance{}, err
 	}
@@ -441,19 +779,19 @@ func (bb *bybit) Balance() ([]base.Balance, error) {
 		ExtCode string `json:"ext_code"`
 		ExtInfo string `json:"ext_info"`
 		Result  map[string]struct {
-			Equity           int     `json:"equity"`
-			AvailableBalance float64 `json:"available_balance"`
-			UsedMargin       float64 `json:"used_margin"`
-			OrderMargin      float64 `json:"order_margin"`
-			PositionMargin   int     `json:"position_margin"`
-			OccClosingFee    int     `json:"occ_closing_fee"`
-			OccFundingFee    int     `json:"occ_funding_fee"`
-			WalletBalance    int     `json:"wallet_balance"`
-			RealisedPnl      int     `json:"realised_pnl"`
-			UnrealisedPnl    int     `json:"unrealised_pnl"`
-			CumRealisedPnl   int     `json:"cum_realised_pnl"`
-			GivenCash        int     `json:"given_cash"`
-			ServiceCash      int     `json:"service_cash"`
+			Equity           number `json:"equity"`
+			AvailableBalance number `json:"available_balance"`
+			UsedMargin       number `json:"used_margin"`
+			OrderMargin      number `json:"order_margin"`
+			PositionMargin   number `json:"position_margin"`
+			OccClosingFee    number `json:"occ_closing_fee"`
+			OccFundingFee    number `json:"occ_funding_fee"`
+			WalletBalance    number `json:"wallet_balance"`
+			RealisedPnl      number `json:"realised_pnl"`
+			UnrealisedPnl    number `json:"unrealised_pnl"`
+			CumRealisedPnl   number `json:"cum_realised_pnl"`
+			GivenCash        number `json:"given_cash"`
+			ServiceCash      number `json:"service_cash"`
 		} `json:"result"`
 		TimeNow          string `json:"time_now"`
 		RateLimitStatus  int    `json:"rate_limit_status"`
@@ -461,13 +799,15 @@ func (bb *bybit) Balance() ([]base.Balance, error) {
 		RateLimit        int    `json:"rate_limit"`
 	}
 	resData := Res{}
-	json.Unmarshal(res, &resData)
+	if err := decode("/v2/private/wallet/balance", res, &resData); err != nil {
+		return []base.Balance{}, err
+	}
 
 	balances := []base.Balance{}
 	for k, v := range resData.Result {
 		balances = append(balances, base.Balance{
 			CurrencyCode: k,
-			Size:         v.AvailableBalance,
+			Size:         float64(v.AvailableBalance),
 		})
 	}
 
@@ -475,10 +815,14 @@ func (bb *bybit) Balance() ([]base.Balance, error) {
 }
 
 func (bb *bybit) Boards(symbol string) (board.Board, error) {
+	return bb.BoardsCtx(context.Background(), symbol)
+}
+
+func (bb *bybit) BoardsCtx(ctx context.Context, symbol string) (board.Board, error) {
 	type Req struct {
 		Symbol string `json:"symbol"`
 	}
-	res, err := bb.getRequest("/v2/public/orderBook/L2", structToMap(&Req{
+	res, err := bb.getRequest(ctx, "/v2/public/orderBook/L2", structToMap(&Req{
 		Symbol: symbol,
 	}))
 	if err != nil {
@@ -492,28 +836,29 @@ func (bb *bybit) Boards(symbol string) (board.Board, error) {
 		ExtInfo string `json:"ext_info"`
 		Result  []struct {
 			Symbol string `json:"symbol"`
-			Price  string `json:"price"`
-			Size   int    `json:"size"`
+			Price  number `json:"price"`
+			Size   number `json:"size"`
 			Side   string `json:"side"`
 		} `json:"result"`
 		TimeNow string `json:"time_now"`
 	}
 	resData := Res{}
-	json.Unmarshal(res, &resData)
+	if err := decode("/v2/public/orderBook/L2", res, &resData); err != nil {
+		return board.Board{}, err
+	}
 
 	asks := []base.Norm{}
 	bids := []base.Norm{}
 
 	for _, v := range resData.Result {
-		price, _ := strconv.ParseFloat(v.Price, 64)
 		if v.Side == "Buy" {
 			bids = append(bids, base.Norm{
-				Price: price,
+				Price: float64(v.Price),
 				Size:  float64(v.Size),
 			})
 		} else {
 			asks = append(asks, base.Norm{
-				Price: price,
+				Price: float64(v.Price),
 				Size:  float64(v.Size),
 			})
 		}
@@ -525,6 +870,9 @@ func (bb *bybit) Boards(symbol string) (board.Board, error) {
 	sort.Slice(bids, func(i, j int) bool {
 		return bids[i].Price > bids[j].Price
 	})
+	if len(asks) == 0 || len(bids) == 0 {
+		return board.Board{}, fmt.Errorf("bybit: /v2/public/orderBook/L2: empty board for %s", symbol)
+	}
 	midPrice := (bids[0].Price + asks[0].Price) / 2
 
 	return board.Board{
@@ -536,43 +884,63 @@ func (bb *bybit) Boards(symbol string) (board.Board, error) {
 	}, nil
 }
 
+// RateLimitStatus return remaining quota per endpoint path.
+func (bb *bybit) RateLimitStatus() map[string]exchange.RateLimit {
+	return bb.rateLimiter.status()
+}
+
 func (bb *bybit) InScheduledMaintenance() bool {
 	// TODO
 	return false
 }
 
-func (bb *bybit) postRequest(path string, param map[string]string) ([]byte, error) {
-	param["api_key"] = bb.key.APIKey
-	param["timestamp"] = fmt.Sprint(time.Now().UnixNano() / 1000000)
-	sign := getSignature(param, bb.key.APISecKey)
-	param["sign"] = sign
-
-	url := url.URL{Scheme: "https", Host: bb.host, Path: path}
-	jsonParam, _ := json.Marshal(param)
-	req, _ := http.NewRequest(
-		"POST",
-		url.String(),
-		bytes.NewBuffer(jsonParam),
-	)
-	req.Header.Add("Content-Type", "application/json")
+func (bb *bybit) postRequest(ctx context.Context, path string, param map[string]string) ([]byte, error) {
+	return bb.send(ctx, "POST", path, param, func() (*http.Request, error) {
+		signed, sign := bb.signParam(param)
+		signed["sign"] = sign
 
-	return bb.request(req)
+		jsonParam, _ := json.Marshal(signed)
+		req, err := http.NewRequestWithContext(
+			ctx,
+			"POST",
+			bb.endpoint(path),
+			bytes.NewBuffer(jsonParam),
+		)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Add("Content-Type", "application/json")
+		return req, nil
+	})
 }
 
-func (bb *bybit) getRequest(path string, param map[string]string) ([]byte, error) {
-	param["api_key"] = bb.key.APIKey
-	param["timestamp"] = fmt.Sprint(time.Now().UnixNano() / 1000000)
-	sign := getSignature(param, bb.key.APISecKey)
-	queryStr := getQuery(param) + "&sign=" + sign
+func (bb *bybit) getRequest(ctx context.Context, path string, param map[string]string) ([]byte, error) {
+	return bb.send(ctx, "GET", path, param, func() (*http.Request, error) {
+		signed, sign := bb.signParam(param)
+		queryStr := getQuery(signed) + "&sign=" + sign
 
-	url := url.URL{Scheme: "https", Host: bb.host, Path: path}
-	req, _ := http.NewRequest(
-		"GET",
-		url.String()+"?"+queryStr,
-		nil, //bytes.NewBuffer([]byte(queryStr)),
-	)
+		return http.NewRequestWithContext(
+			ctx,
+			"GET",
+			bb.endpoint(path)+"?"+queryStr,
+			nil, //bytes.NewBuffer([]byte(queryStr)),
+		)
+	})
+}
 
-	return bb.request(req)
+// signParam return copy of param with api_key, timestamp and its signature.
+// リトライ時に毎回新しいtimestampで署名し直すため元のmapは変更しない
+func (bb *bybit) signParam(param map[string]string) (map[string]string, string) {
+	signed := make(map[string]string, len(param)+3)
+	for k, v := range param {
+		signed[k] = v
+	}
+	signed["api_key"] = bb.key.APIKey
+	signed["timestamp"] = fmt.Sprint(bb.timestamp().UnixNano() / 1000000)
+	if bb.recvWindow > 0 {
+		signed["recv_window"] = fmt.Sprint(bb.recvWindow.Milliseconds())
+	}
+	return signed, getSignature(signed, bb.key.APISecKey)
 }
 
 func getSignature(params map[string]string, key string) string {
@@ -598,57 +966,85 @@ func getQuery(params map[string]string) string {
 	return _val[0 : len(_val)-1]
 }
 
+// structToMap json tagをkeyにする. omitemptyのフィールドはゼロ値なら、nilのpointerは常に送らない
 func structToMap(data interface{}) map[string]string {
 	result := make(map[string]string)
 	elem := reflect.ValueOf(data).Elem()
 	size := elem.NumField()
 
 	for i := 0; i < size; i++ {
-		field := elem.Type().Field(i).Tag.Get("json")
-		value := elem.Field(i).Interface()
-		result[field] = fmt.Sprint(value)
+		tag := strings.Split(elem.Type().Field(i).Tag.Get("json"), ",")
+		field := elem.Field(i)
+		if len(tag) > 1 && tag[1] == "omitempty" && field.IsZero() {
+			continue
+		}
+		// pointerは指している値を送る (0を送りたい項目に使う)
+		if field.Kind() == reflect.Ptr {
+			if field.IsNil() {
+				continue
+			}
+			field = field.Elem()
+		}
+		result[tag[0]] = fmt.Sprint(field.Interface())
 	}
 	return result
 }
 
 func (bb *bybit) request(req *http.Request) ([]byte, error) {
+	startedAt := time.Now()
+	body, status, err := bb.roundTrip(req)
+	bb.logRequest(req, status, time.Since(startedAt), err)
+	return body, err
+}
+
+func (bb *bybit) roundTrip(req *http.Request) ([]byte, int, error) {
 	resp, err := bb.httpClient.Do(req)
 
 	if err != nil {
-		errStr := fmt.Sprintf("err ==> %+v\nreq ==> %v\n", err, req)
-		return nil, errors.New(errStr)
-	}
-	if resp.StatusCode/100 != 2 {
-		body, _ := ioutil.ReadAll(resp.Body)
-		errStr := fmt.Sprintf("code:%d\n", resp.StatusCode)
-		errStr += fmt.Sprintf("body ==> %s\n", string(body))
-		errStr += fmt.Sprintf("resp ==> %+v\nreq ==> %v\n", resp, req)
-		return nil, errors.New(errStr)
+		// キャンセル、デッドライン超過はerrors.Isで判別できるようにラップして返す
+		if ctxErr := req.Context().Err(); ctxErr != nil {
+			return nil, 0, fmt.Errorf("%s %s: %w", req.Method, req.URL.Path, ctxErr)
+		}
+		// url.Errorにはapi_key, signを含むurlが入っているので伏せる
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			urlErr.URL = redactURL(req.URL)
+		}
+		return nil, 0, fmt.Errorf("%s %s: %w", req.Method, req.URL.Path, err)
 	}
-
 	defer resp.Body.Close()
+
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		log.Fatal(err)
+		return nil, resp.StatusCode, fmt.Errorf("%s %s: read body: %w", req.Method, req.URL.Path, err)
 	}
 
-	type errCheck struct {
-		Fail    int    `json:"ret_code"`
-		Message string `json:"ret_msg"`
-		Code    string `json:"ext_code"`
-		Info    string `json:"ext_info"`
+	group := rateLimitGroup(req.URL.Path)
+	limit := rateLimitBody{}
+	json.Unmarshal(body, &limit)
+	bb.rateLimiter.update(group, resp.Header, limit)
+
+	if resp.StatusCode/100 != 2 {
+		apiErr := newAPIError(req.URL.Path, resp.StatusCode, body)
+		if errors.Is(apiErr, ErrRateLimited) {
+			bb.rateLimiter.exhaust(group, msToTime(int64(limit.RateLimitResetMs)))
+		}
+		return nil, resp.StatusCode, apiErr
 	}
-	check := errCheck{}
-	err = json.Unmarshal(body, &check)
-	if check.Fail != 0 || err != nil {
-		msg := fmt.Sprintf("msg: %s\n info: %s\n code: %s\n", check.Message, check.Info, check.Code)
-		if err != nil {
-			msg = err.Error()
+
+	check := apiStatus{}
+	if err := json.Unmarshal(body, &check); err != nil {
+		return nil, resp.StatusCode, fmt.Errorf("%s %s: %w", req.Method, req.URL.Path, err)
+	}
+	if check.RetCode != 0 {
+		apiErr := check.toError(req.URL.Path, resp.StatusCode)
+		if errors.Is(apiErr, ErrRateLimited) {
+			bb.rateLimiter.exhaust(group, msToTime(int64(limit.RateLimitResetMs)))
 		}
-		return nil, errors.New(msg)
+		return nil, resp.StatusCode, apiErr
 	}
 
-	return body, err
+	return body, resp.StatusCode, nil
 }
 
 func (bb *bybit) UpdateLTP(lastTimePrice float64) error {
@@ -0,0 +1,1009 @@
+package bybit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TTRSQ/bbwrapper/domains/base"
+	"github.com/TTRSQ/bbwrapper/domains/kline"
+	"github.com/TTRSQ/bbwrapper/domains/order"
+	"github.com/TTRSQ/bbwrapper/domains/order/id"
+	"github.com/TTRSQ/bbwrapper/domains/position"
+	"github.com/TTRSQ/bbwrapper/interface/exchange"
+)
+
+// fixtureTransport path毎にtestdata以下のjsonを返す
+type fixtureTransport map[string]string
+
+func (f fixtureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	file, ok := f[req.URL.Path]
+	if !ok {
+		return &http.Response{
+			StatusCode: http.StatusNotFound,
+			Body:       ioutil.NopCloser(bytes.NewBufferString("not found")),
+			Request:    req,
+		}, nil
+	}
+	body, err := ioutil.ReadFile(filepath.Join("testdata", file))
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       ioutil.NopCloser(bytes.NewBuffer(body)),
+		Request:    req,
+	}, nil
+}
+
+func jsonResponse(req *http.Request, status int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: status,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       ioutil.NopCloser(bytes.NewBufferString(body)),
+		Request:    req,
+	}
+}
+
+func newFixtureClient(t *testing.T, fixtures fixtureTransport) *bybit {
+	t.Helper()
+	ex, err := New(exchange.Key{APIKey: "hoge", APISecKey: "fuga"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bb := ex.(*bybit)
+	bb.httpClient = &http.Client{Transport: fixtures}
+	return bb
+}
+
+// slowTransport ctxが終わるまでレスポンスを返さない
+type slowTransport struct{}
+
+func (slowTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	select {
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	case <-time.After(5 * time.Second):
+		return nil, errors.New("slowTransport: no response")
+	}
+}
+
+func TestContextCancel(t *testing.T) {
+	retry := DefaultRetryPolicy()
+	retry.BaseDelay = time.Second
+	for name, policy := range map[string]RetryPolicy{"no retry": {}, "retry": retry} {
+		ex, err := New(exchange.Key{APIKey: "hoge", APISecKey: "fuga"}, WithRetryPolicy(policy))
+		if err != nil {
+			t.Fatal(err)
+		}
+		bb := ex.(*bybit)
+		bb.httpClient = &http.Client{Transport: slowTransport{}}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := bb.ActiveOrdersCtx(ctx, "BTCUSD"); !errors.Is(err, context.Canceled) {
+			t.Errorf("%s: GET err = %v, want context.Canceled", name, err)
+		}
+		if _, err := bb.CreateOrderCtx(ctx, 8800.5, 3, true, "BTCUSD", "Limit"); !errors.Is(err, context.Canceled) {
+			t.Errorf("%s: POST err = %v, want context.Canceled", name, err)
+		}
+
+		ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+		if _, err := bb.ActiveOrdersCtx(ctx, "BTCUSD"); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("%s: GET err = %v, want context.DeadlineExceeded", name, err)
+		}
+		cancel()
+		ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+		if err := bb.CancelAllOrderCtx(ctx, "BTCUSD"); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("%s: POST err = %v, want context.DeadlineExceeded", name, err)
+		}
+		cancel()
+	}
+
+	// リトライ待ちの間にデッドラインを過ぎた場合
+	ex, err := New(exchange.Key{APIKey: "hoge", APISecKey: "fuga"}, WithRetryPolicy(retry))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bb := ex.(*bybit)
+	bb.httpClient = &http.Client{Transport: RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return jsonResponse(req, http.StatusBadGateway, "bad gateway"), nil
+	})}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := bb.ActiveOrdersCtx(ctx, "BTCUSD"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+// statusTransport 全てのリクエストにstatusとbodyを返す
+type statusTransport struct {
+	status int
+	body   string
+}
+
+func (s statusTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return &http.Response{
+		StatusCode: s.status,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       ioutil.NopCloser(strings.NewReader(s.body)),
+		Request:    req,
+	}, nil
+}
+
+func TestAPIErrorSentinel(t *testing.T) {
+	cases := []struct {
+		status  int
+		retCode int
+		want    error
+	}{
+		{http.StatusOK, 10002, ErrTimestampOutOfWindow},
+		{http.StatusOK, 10004, ErrInvalidSignature},
+		{http.StatusOK, 10006, ErrRateLimited},
+		{http.StatusOK, 10018, ErrRateLimited},
+		{http.StatusOK, 20001, ErrOrderNotFound},
+		{http.StatusOK, 30001, ErrDuplicateClientID},
+		{http.StatusOK, 30032, ErrOrderNotFound},
+		{http.StatusOK, 30034, ErrOrderNotFound},
+		{http.StatusOK, 30037, ErrOrderNotFound},
+		{http.StatusOK, 30031, ErrInsufficientBalance},
+		{http.StatusOK, 30042, ErrInsufficientBalance},
+		{http.StatusOK, 30049, ErrInsufficientBalance},
+		{http.StatusOK, 30063, ErrReduceOnly},
+		// IP制限はret_codeなしのHTTPステータスで返る
+		{http.StatusForbidden, 0, ErrRateLimited},
+		{http.StatusTooManyRequests, 0, ErrRateLimited},
+		{http.StatusInternalServerError, 0, nil},
+		{http.StatusOK, 10001, nil},
+	}
+	sentinels := []error{ErrInsufficientBalance, ErrOrderNotFound, ErrRateLimited, ErrInvalidSignature, ErrTimestampOutOfWindow, ErrReduceOnly, ErrDuplicateClientID}
+
+	covered := map[int]bool{}
+	for _, c := range cases {
+		covered[c.retCode] = true
+		retMsg := fmt.Sprintf("error %d", c.retCode)
+		ex, err := New(exchange.Key{APIKey: "hoge", APISecKey: "fuga"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		bb := ex.(*bybit)
+		bb.httpClient = &http.Client{Transport: statusTransport{c.status, fmt.Sprintf(`{"ret_code":%d,"ret_msg":%q}`, c.retCode, retMsg)}}
+
+		_, err = bb.ActiveOrders("BTCUSD")
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) {
+			t.Errorf("%d/%d: err = %v, want APIError", c.status, c.retCode, err)
+			continue
+		}
+		if apiErr.RetCode != c.retCode || apiErr.RetMsg != retMsg || apiErr.HTTPStatus != c.status {
+			t.Errorf("%d/%d: api error = %+v", c.status, c.retCode, apiErr)
+		}
+		for _, sentinel := range sentinels {
+			if got := errors.Is(err, sentinel); got != (sentinel == c.want) {
+				t.Errorf("%d/%d: errors.Is(err, %v) = %v", c.status, c.retCode, sentinel, got)
+			}
+		}
+	}
+	for code := range retCodeErrors {
+		if !covered[code] {
+			t.Errorf("ret_code %d is not tested", code)
+		}
+	}
+}
+
+// capturedParams params (json body and query) of the last request of each path.
+type capturedParams map[string]map[string]string
+
+// captureParams route requests of bb to next and record their params.
+func captureParams(bb *bybit, next http.RoundTripper) capturedParams {
+	captured := capturedParams{}
+	bb.httpClient = &http.Client{Transport: RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		params := map[string]string{}
+		if req.Body != nil {
+			body, _ := ioutil.ReadAll(req.Body)
+			json.Unmarshal(body, &params)
+		}
+		for key, values := range req.URL.Query() {
+			params[key] = values[0]
+		}
+		captured[req.URL.Path] = params
+		return next.RoundTrip(req)
+	})}
+	return captured
+}
+
+func TestCreateOrderDecode(t *testing.T) {
+	bb := newFixtureClient(t, fixtureTransport{"/v2/private/order/create": "order_create.json"})
+
+	res, err := bb.CreateOrder(8800.5, 3, true, "BTCUSD", "Limit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.ID.LocalID != "335fd977-e5a5-4781-b6d0-c772d5bfb95b" {
+		t.Errorf("LocalID = %s", res.ID.LocalID)
+	}
+	if res.FilledSize != 2 {
+		t.Errorf("FilledSize = %v, want 2", res.FilledSize)
+	}
+}
+
+func TestCreateOrderByRequest(t *testing.T) {
+	fixtures := fixtureTransport{"/v2/private/order/create": "order_create.json"}
+	bb := newFixtureClient(t, fixtures)
+	captured := captureParams(bb, fixtures)
+
+	req := order.CreateRequest{
+		Request: order.Request{
+			Norm:      base.Norm{Price: 8800.5, Size: 3},
+			Symbol:    "BTCUSD",
+			IsBuy:     false,
+			OrderType: bb.OrderTypes().Limit,
+		},
+		TimeInForce: bb.TimeInForces().PostOnly,
+		ReduceOnly:  true,
+		OrderLinkID: "hoge-1",
+		TakeProfit:  8000,
+		TpTriggerBy: bb.TriggerTypes().LastPrice,
+	}
+	if _, err := bb.CreateOrderByRequest(req); err != nil {
+		t.Fatal(err)
+	}
+	params := captured["/v2/private/order/create"]
+	if params["time_in_force"] != "PostOnly" || params["reduce_only"] != "true" || params["order_link_id"] != "hoge-1" || params["side"] != "Sell" {
+		t.Errorf("params = %v", params)
+	}
+	if params["take_profit"] != "8000" || params["tp_trigger_by"] != "LastPrice" {
+		t.Errorf("params = %v", params)
+	}
+	// 指定しなかったフラグは送らない
+	if _, ok := params["close_on_trigger"]; ok {
+		t.Errorf("params = %v", params)
+	}
+	if _, ok := params["stop_loss"]; ok {
+		t.Errorf("params = %v", params)
+	}
+
+	req.OrderType = bb.OrderTypes().Market
+	if _, err := bb.CreateOrderByRequest(req); err == nil {
+		t.Error("PostOnly market order must be error")
+	}
+	req.TimeInForce = "GoodTillDate"
+	if _, err := bb.CreateOrderByRequest(req); err == nil {
+		t.Error("unknown time in force must be error")
+	}
+}
+
+func TestClientOrderID(t *testing.T) {
+	fixtures := fixtureTransport{
+		"/v2/private/order/create": "order_create.json",
+		"/v2/private/order/cancel": "order_cancel.json",
+		"/v2/private/order":        "order_query.json",
+	}
+	ex, err := New(exchange.Key{APIKey: "hoge", APISecKey: "fuga"}, WithClientIDGenerator(id.GeneratorFunc(func() string {
+		return "mm-1"
+	})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bb := ex.(*bybit)
+	captured := captureParams(bb, fixtures)
+
+	// 指定しなければgeneratorのidが付く
+	res, err := bb.CreateOrder(8800.5, 3, true, "BTCUSD", "Limit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := captured["/v2/private/order/create"]
+	if params["order_link_id"] != "mm-1" || res.ID.ClientID != "mm-1" {
+		t.Errorf("params = %v, id = %+v", params, res.ID)
+	}
+
+	if err := bb.CancelOrderByClientID("BTCUSD", "mm-1"); err != nil {
+		t.Fatal(err)
+	}
+	params = captured["/v2/private/order/cancel"]
+	if _, ok := params["order_id"]; ok || params["order_link_id"] != "mm-1" {
+		t.Errorf("params = %v", params)
+	}
+
+	o, err := bb.OrderByClientID("BTCUSD", "mm-kdc4yvx3-0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	params = captured["/v2/private/order"]
+	if params["order_link_id"] != "mm-kdc4yvx3-0" {
+		t.Errorf("params = %v", params)
+	}
+	if o.LocalID != "e66b101a-ef3f-4647-83b5-28e0f38dcae0" || o.ClientID != "mm-kdc4yvx3-0" || o.Price != 8800.5 || o.Size != 3 || !o.IsBuy {
+		t.Errorf("order = %+v", o)
+	}
+}
+
+func TestConditionalOrder(t *testing.T) {
+	fixtures := fixtureTransport{
+		"/v2/private/stop-order/create": "stop_order_create.json",
+		"/v2/private/stop-order/list":   "stop_order_list.json",
+	}
+	bb := newFixtureClient(t, fixtures)
+	captured := captureParams(bb, fixtures)
+
+	// stop-market
+	res, err := bb.CreateConditionalOrder(order.ConditionalRequest{
+		CreateRequest: order.CreateRequest{
+			Request: order.Request{
+				Norm:      base.Norm{Size: 10},
+				Symbol:    "BTCUSD",
+				OrderType: bb.OrderTypes().Market,
+			},
+		},
+		StopPx:    8800,
+		BasePx:    8900,
+		TriggerBy: bb.TriggerTypes().MarkPrice,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.ID.LocalID != "a85cd1c0-a9a4-49d3-a1bd-bab5ebe946d5" {
+		t.Errorf("id = %+v", res.ID)
+	}
+	params := captured["/v2/private/stop-order/create"]
+	if params["stop_px"] != "8800" || params["base_price"] != "8900" || params["trigger_by"] != "MarkPrice" || params["time_in_force"] != "GoodTillCancel" {
+		t.Errorf("params = %v", params)
+	}
+	if _, ok := params["price"]; ok {
+		t.Errorf("stop-market must not send price: %v", params)
+	}
+
+	orders, err := bb.ActiveConditionalOrders("BTCUSD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orders) != 1 || orders[0].StopPx != 8950 || orders[0].BasePx != 8500 || orders[0].Price != 9000 || orders[0].TriggerBy != "LastPrice" || orders[0].Status != "Untriggered" {
+		t.Errorf("orders = %+v", orders)
+	}
+
+	if _, err := bb.CreateConditionalOrder(order.ConditionalRequest{
+		CreateRequest: order.CreateRequest{Request: order.Request{Norm: base.Norm{Size: 1}, Symbol: "BTCUSD", OrderType: "Market"}},
+		StopPx:        8800,
+		BasePx:        8900,
+		TriggerBy:     "Funding",
+	}); err == nil {
+		t.Error("unknown trigger type must be error")
+	}
+}
+
+func TestEditOrderDecode(t *testing.T) {
+	bb := newFixtureClient(t, fixtureTransport{"/v2/private/order/replace": "order_replace.json"})
+
+	o, err := bb.EditOrder("BTCUSD", "efa44157-c355-4a98-b6d6-1d846a936b93", 8000, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.LocalID != "efa44157-c355-4a98-b6d6-1d846a936b93" {
+		t.Errorf("LocalID = %s", o.LocalID)
+	}
+	if o.UpdatedAtUnix != 1539778407 {
+		t.Errorf("UpdatedAtUnix = %d", o.UpdatedAtUnix)
+	}
+}
+
+func TestCancelOrderDecode(t *testing.T) {
+	bb := newFixtureClient(t, fixtureTransport{"/v2/private/order/cancel": "order_cancel.json"})
+
+	if err := bb.CancelOrder("BTCUSD", "3bd1844f-f3c0-4e10-8c25-10fea03763f6"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestActiveOrdersDecode(t *testing.T) {
+	bb := newFixtureClient(t, fixtureTransport{"/v2/private/order/list": "order_list.json"})
+
+	orders, err := bb.ActiveOrders("BTCUSD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orders) != 1 {
+		t.Fatalf("len(orders) = %d", len(orders))
+	}
+	o := orders[0]
+	if o.Price != 9800.5 || o.Size != 16 || o.IsBuy {
+		t.Errorf("order = %+v", o)
+	}
+	if o.UpdatedAtUnix != 1579527370 {
+		t.Errorf("UpdatedAtUnix = %d", o.UpdatedAtUnix)
+	}
+}
+
+func TestStocksDecode(t *testing.T) {
+	bb := newFixtureClient(t, fixtureTransport{"/v2/private/position/list": "position_list.json"})
+
+	s, err := bb.Stocks("BTCUSD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Summary != -5 || s.ShortSize != 5 || s.LongSize != 0 {
+		t.Errorf("stock = %+v", s)
+	}
+	if s.TakeProfit != 6800 || s.StopLoss != 7500 || s.TrailingStop != 50 {
+		t.Errorf("trading stop = %+v", s)
+	}
+}
+
+func TestSetTradingStop(t *testing.T) {
+	bb := newFixtureClient(t, fixtureTransport{})
+	captured := captureParams(bb, RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return jsonResponse(req, http.StatusOK, `{"ret_code":0,"ret_msg":"OK","result":{"symbol":"BTCUSD","take_profit":0,"stop_loss":7500}}`), nil
+	}))
+
+	takeProfit, stopLoss := 0.0, 7500.0
+	err := bb.SetTradingStop(position.TradingStop{
+		Symbol:      "BTCUSD",
+		TakeProfit:  &takeProfit,
+		StopLoss:    &stopLoss,
+		SlTriggerBy: bb.TriggerTypes().MarkPrice,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 0は解除として送り、指定しなかったtrailing stopは送らない
+	params := captured["/v2/private/position/trading-stop"]
+	if params["take_profit"] != "0" || params["stop_loss"] != "7500" || params["sl_trigger_by"] != "MarkPrice" {
+		t.Errorf("params = %v", params)
+	}
+	if _, ok := params["trailing_stop"]; ok {
+		t.Errorf("params = %v", params)
+	}
+
+	if err := bb.SetTradingStop(position.TradingStop{Symbol: "BTCUSD"}); err == nil {
+		t.Error("empty trading stop must be error")
+	}
+}
+
+func TestLiquidationOrder(t *testing.T) {
+	fixtures := fixtureTransport{
+		"/v2/private/position/list": "position_list.json",
+		"/v2/private/order":         "order_query_none.json",
+		"/v2/private/order/create":  "order_create.json",
+	}
+	bb := newFixtureClient(t, fixtures)
+	captured := captureParams(bb, fixtures)
+	WithCloseOnTrigger(true)(bb)
+
+	// ショート5に対して10の買いはポジション分に切り詰める
+	if _, err := bb.LiquidationOrder(0, 10, true, "BTCUSD", bb.OrderTypes().Market); err != nil {
+		t.Fatal(err)
+	}
+	params := captured["/v2/private/order/create"]
+	if params["qty"] != "5" || params["side"] != "Buy" || params["reduce_only"] != "true" || params["close_on_trigger"] != "true" {
+		t.Errorf("params = %v", params)
+	}
+
+	// ショートに売りを重ねることはできない
+	delete(captured, "/v2/private/order/create")
+	_, err := bb.LiquidationOrder(8800, 1, false, "BTCUSD", bb.OrderTypes().Limit)
+	if !errors.Is(err, ErrReduceOnly) {
+		t.Errorf("err = %v", err)
+	}
+	if params, ok := captured["/v2/private/order/create"]; ok {
+		t.Errorf("order must not be sent: %v", params)
+	}
+
+	// ショート5のうち2は既存のreduce-only買い注文で決済される. reduce-onlyでない注文と売りは数えない
+	fixtures["/v2/private/order"] = "order_query_list.json"
+	if _, err := bb.LiquidationOrder(0, 10, true, "BTCUSD", bb.OrderTypes().Market); err != nil {
+		t.Fatal(err)
+	}
+	if params := captured["/v2/private/order/create"]; params["qty"] != "3" {
+		t.Errorf("params = %v", params)
+	}
+}
+
+func TestBalanceDecode(t *testing.T) {
+	bb := newFixtureClient(t, fixtureTransport{"/v2/private/wallet/balance": "wallet_balance.json"})
+
+	balances, err := bb.Balance()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(balances) != 1 || balances[0].CurrencyCode != "BTC" || balances[0].Size != 999.99987471 {
+		t.Errorf("balances = %+v", balances)
+	}
+}
+
+func TestBoardsDecode(t *testing.T) {
+	bb := newFixtureClient(t, fixtureTransport{"/v2/public/orderBook/L2": "orderbook_l2.json"})
+
+	b, err := bb.Boards("BTCUSD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b.Asks) != 2 || len(b.Bids) != 2 {
+		t.Fatalf("board = %+v", b)
+	}
+	if b.Bids[0].Price != 9487 || b.Asks[0].Price != 9488 || b.MidPrice != 9487.5 {
+		t.Errorf("board = %+v", b)
+	}
+}
+
+func TestOpenInterestDecode(t *testing.T) {
+	bb := newFixtureClient(t, fixtureTransport{"/v2/public/open-interest": "open_interest.json"})
+
+	ois, err := bb.OpenInterest("BTCUSD", 5, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ois) != 2 || ois[0].OpenInterest != 805604444 || ois[0].Timestamp != 1609813800 {
+		t.Errorf("open interest = %+v", ois)
+	}
+}
+
+func TestTickerDecode(t *testing.T) {
+	bb := newFixtureClient(t, fixtureTransport{"/v2/public/tickers": "tickers.json"})
+
+	tk, err := bb.Ticker("BTCUSD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tk.BestBid != 7230 || tk.BestAsk != 7230.5 || tk.MarkPrice != 7230.31 || tk.FundingRate != 0.0001 || tk.Volume24h != 78053288 {
+		t.Errorf("ticker = %+v", tk)
+	}
+	if !tk.NextFundingTime.Equal(time.Date(2019, 12, 28, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("next funding time = %v", tk.NextFundingTime)
+	}
+}
+
+func TestKlinesDecode(t *testing.T) {
+	bb := newFixtureClient(t, fixtureTransport{
+		"/v2/public/kline/list":       "kline_list.json",
+		"/v2/public/mark-price-kline": "mark_price_kline.json",
+	})
+
+	ks, err := bb.Klines("BTCUSD", "1", time.Unix(1581231200, 0), 1, kline.PriceTrade)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ks) != 1 || ks[0].OpenTime.Unix() != 1581231260 || ks[0].Open != 10112.5 || ks[0].Volume != 75 || !ks[0].Confirmed {
+		t.Errorf("klines = %+v", ks)
+	}
+
+	ks, err = bb.Klines("BTCUSD", "1", time.Unix(1589889000, 0), 1, kline.PriceMark)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ks) != 1 || ks[0].OpenTime.Unix() != 1589889120 || ks[0].Close != 9755.3 {
+		t.Errorf("mark price klines = %+v", ks)
+	}
+
+	if _, err := bb.Klines("BTCUSD", "2", time.Now(), 1, kline.PriceTrade); err == nil {
+		t.Error("unknown interval must be error")
+	}
+}
+
+func TestLiquidationsDecode(t *testing.T) {
+	bb := newFixtureClient(t, fixtureTransport{"/v2/public/liq-records": "liq_records.json"})
+
+	ls, err := bb.Liquidations("BTCUSD", time.Unix(1582616400, 0), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ls) != 2 || !ls[0].IsBuy || ls[0].Price != 8838.5 || ls[0].Size != 3 || ls[1].IsBuy {
+		t.Fatalf("liquidations = %+v", ls)
+	}
+	if !ls[0].OccuredAt.Equal(time.Unix(1582616462, 0)) {
+		t.Errorf("occured at = %v", ls[0].OccuredAt)
+	}
+}
+
+func TestDecodeError(t *testing.T) {
+	v := struct {
+		Price number `json:"price"`
+	}{}
+	if err := decode("/test", []byte(`{"price":"abc"}`), &v); err == nil {
+		t.Error("invalid numeric string must be reported")
+	}
+	if err := decode("/test", []byte(`{"price":"12.5"}`), &v); err != nil || v.Price != 12.5 {
+		t.Errorf("price = %v, err = %v", v.Price, err)
+	}
+}
+
+func TestRateLimitFailFast(t *testing.T) {
+	resetMs := time.Now().Add(time.Minute).UnixNano() / int64(time.Millisecond)
+	calls := 0
+	ex, err := New(exchange.Key{APIKey: "hoge", APISecKey: "fuga"}, WithRateLimitPolicy(RateLimitFailFast))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bb := ex.(*bybit)
+	bb.httpClient = &http.Client{Transport: RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		calls++
+		return jsonResponse(req, http.StatusOK, fmt.Sprintf(
+			`{"ret_code":0,"ret_msg":"OK","result":[],"rate_limit_status":0,"rate_limit_reset_ms":%d,"rate_limit":100}`, resetMs,
+		)), nil
+	})}
+
+	if err := bb.CancelAllOrder("BTCUSD"); err != nil {
+		t.Fatal(err)
+	}
+	status := bb.RateLimitStatus()["/v2/private/order/cancelAll"]
+	if status.Remaining != 0 || status.Limit != 100 {
+		t.Errorf("status = %+v", status)
+	}
+
+	if err := bb.CancelAllOrder("BTCUSD"); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("err = %v, want ErrRateLimited", err)
+	}
+	if calls != 1 {
+		t.Errorf("calls = %d, request must not be sent", calls)
+	}
+}
+
+func TestRateLimitCountsRequests(t *testing.T) {
+	resetMs := time.Now().Add(time.Minute).UnixNano() / int64(time.Millisecond)
+	calls := 0
+	ex, err := New(exchange.Key{APIKey: "hoge", APISecKey: "fuga"}, WithRateLimitPolicy(RateLimitFailFast))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bb := ex.(*bybit)
+	bb.httpClient = &http.Client{Transport: RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		calls++
+		if calls > 1 {
+			// 残量を返さない応答では手元の数え方が使われる
+			return jsonResponse(req, http.StatusOK, `{"ret_code":0,"ret_msg":"OK","result":[]}`), nil
+		}
+		return jsonResponse(req, http.StatusOK, fmt.Sprintf(
+			`{"ret_code":0,"ret_msg":"OK","result":[],"rate_limit_status":1,"rate_limit_reset_ms":%d,"rate_limit":100}`, resetMs,
+		)), nil
+	})}
+
+	for i := 0; i < 2; i++ {
+		if err := bb.CancelAllOrder("BTCUSD"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if status := bb.RateLimitStatus()["/v2/private/order/cancelAll"]; status.Remaining != 0 {
+		t.Errorf("status = %+v", status)
+	}
+	if err := bb.CancelAllOrder("BTCUSD"); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("err = %v, want ErrRateLimited", err)
+	}
+	if calls != 2 {
+		t.Errorf("calls = %d, want 2", calls)
+	}
+}
+
+func TestRateLimitCoolDown(t *testing.T) {
+	for name, res := range map[string]struct {
+		status int
+		body   string
+	}{
+		"403":   {http.StatusForbidden, "forbidden"},
+		"10006": {http.StatusOK, `{"ret_code":10006,"ret_msg":"too many visits","result":null}`},
+	} {
+		calls := 0
+		ex, err := New(exchange.Key{APIKey: "hoge", APISecKey: "fuga"}, WithRateLimitPolicy(RateLimitBlock))
+		if err != nil {
+			t.Fatal(err)
+		}
+		bb := ex.(*bybit)
+		bb.rateLimiter.coolDown = 50 * time.Millisecond
+		bb.httpClient = &http.Client{Transport: RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			calls++
+			return jsonResponse(req, res.status, res.body), nil
+		})}
+
+		// リセット時刻がなくてもcoolDownの間は送らずに待つ
+		if _, err := bb.ActiveOrders("BTCUSD"); !errors.Is(err, ErrRateLimited) {
+			t.Fatalf("%s: err = %v", name, err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		if _, err := bb.ActiveOrdersCtx(ctx, "BTCUSD"); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("%s: err = %v, want context.DeadlineExceeded", name, err)
+		}
+		cancel()
+		if calls != 1 {
+			t.Errorf("%s: calls = %d, request must not be sent", name, calls)
+		}
+
+		// coolDownの後は送る
+		start := time.Now()
+		bb.ActiveOrders("BTCUSD")
+		if calls != 2 {
+			t.Errorf("%s: calls = %d, want 2", name, calls)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("%s: waited %s", name, elapsed)
+		}
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	calls := 0
+	policy := DefaultRetryPolicy()
+	policy.BaseDelay = 5 * time.Millisecond
+	ex, err := New(exchange.Key{APIKey: "hoge", APISecKey: "fuga"}, WithRetryPolicy(policy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bb := ex.(*bybit)
+	timestamps := map[string]bool{}
+	bb.httpClient = &http.Client{Transport: RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		calls++
+		timestamps[req.URL.Query().Get("timestamp")+req.URL.Query().Get("sign")] = true
+		return jsonResponse(req, http.StatusBadGateway, "bad gateway"), nil
+	})}
+
+	// GETはリトライされる
+	if _, err := bb.ActiveOrders("BTCUSD"); err == nil {
+		t.Fatal("error expected")
+	}
+	if calls != policy.MaxAttempts {
+		t.Errorf("calls = %d, want %d", calls, policy.MaxAttempts)
+	}
+	if len(timestamps) != calls {
+		t.Errorf("each attempt must be signed again")
+	}
+
+	// order_link_idのない注文作成はリトライしない
+	calls = 0
+	var apiErr *APIError
+	if _, err := bb.CreateOrder(9000, 1, true, "BTCUSD", "Limit"); !errors.As(err, &apiErr) || apiErr.HTTPStatus != http.StatusBadGateway {
+		t.Fatalf("err = %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("calls = %d, want 1", calls)
+	}
+}
+
+func TestRetryDuplicateClientID(t *testing.T) {
+	policy := DefaultRetryPolicy()
+	policy.BaseDelay = 5 * time.Millisecond
+	ex, err := New(exchange.Key{APIKey: "hoge", APISecKey: "fuga"}, WithRetryPolicy(policy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bb := ex.(*bybit)
+	creates := 0
+	fixtures := fixtureTransport{"/v2/private/order": "order_query.json"}
+	bb.httpClient = &http.Client{Transport: RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Path != "/v2/private/order/create" {
+			return fixtures.RoundTrip(req)
+		}
+		creates++
+		if creates == 1 {
+			// 取引所には届いたが応答が返らなかった
+			return jsonResponse(req, http.StatusBadGateway, "bad gateway"), nil
+		}
+		return jsonResponse(req, http.StatusOK, `{"ret_code":30001,"ret_msg":"order_link_id is repeated","result":null}`), nil
+	})}
+
+	req := order.CreateRequest{
+		Request: order.Request{
+			Norm:      base.Norm{Price: 8800.5, Size: 3},
+			Symbol:    "BTCUSD",
+			IsBuy:     true,
+			OrderType: bb.OrderTypes().Limit,
+		},
+		OrderLinkID: "mm-kdc4yvx3-0",
+	}
+	res, err := bb.CreateOrderByRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creates != 2 {
+		t.Errorf("creates = %d, want 2", creates)
+	}
+	if res.ID.LocalID != "e66b101a-ef3f-4647-83b5-28e0f38dcae0" || res.ID.ClientID != "mm-kdc4yvx3-0" || res.FilledSize != 0 {
+		t.Errorf("res = %+v", res)
+	}
+
+	// 初回から重複している場合は別の注文なのでエラーのまま返す
+	creates = 1
+	if _, err := bb.CreateOrderByRequest(req); !errors.Is(err, ErrDuplicateClientID) {
+		t.Errorf("err = %v, want ErrDuplicateClientID", err)
+	}
+}
+
+func TestIdempotent(t *testing.T) {
+	cases := []struct {
+		method, path string
+		param        map[string]string
+		want         bool
+	}{
+		{http.MethodGet, "/v2/private/order/list", nil, true},
+		{http.MethodPost, "/v2/private/order/create", nil, false},
+		{http.MethodPost, "/v2/private/order/create", map[string]string{"order_link_id": "hoge-1"}, true},
+		{http.MethodPost, "/v2/private/stop-order/create", nil, false},
+		{http.MethodPost, "/v2/private/order/cancel", nil, true},
+		{http.MethodPost, "/v2/private/position/trading-stop", nil, true},
+		// 一覧にないPOSTは安全か分からないのでリトライしない
+		{http.MethodPost, "/v2/private/position/leverage/save", nil, false},
+	}
+	for _, c := range cases {
+		if got := idempotent(c.method, c.path, c.param); got != c.want {
+			t.Errorf("%s %s %v: idempotent = %v", c.method, c.path, c.param, got)
+		}
+	}
+}
+
+func TestWithBaseURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/public/open-interest" || r.URL.Query().Get("symbol") != "BTCUSD" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		body, _ := ioutil.ReadFile(filepath.Join("testdata", "open_interest.json"))
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	ex, err := New(exchange.Key{APIKey: "hoge", APISecKey: "fuga"}, WithBaseURL(server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ex.OpenInterest("BTCUSD", 5, 2); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := New(exchange.Key{APIKey: "hoge", APISecKey: "fuga"}, WithBaseURL("ftp://example.com")); err == nil {
+		t.Error("unsupported scheme must be rejected")
+	}
+}
+
+func TestSpecificParam(t *testing.T) {
+	ex, err := New(exchange.Key{
+		APIKey:        "hoge",
+		APISecKey:     "fuga",
+		SpecificParam: map[string]interface{}{"timeoutMS": float64(1500), "testnet": true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bb := ex.(*bybit)
+	if bb.httpClient.Timeout != 1500*time.Millisecond {
+		t.Errorf("timeout = %s", bb.httpClient.Timeout)
+	}
+	if bb.baseURL.Host != "api-testnet.bybit.com" {
+		t.Errorf("host = %s", bb.baseURL.Host)
+	}
+
+	_, err = New(exchange.Key{
+		APIKey:        "hoge",
+		APISecKey:     "fuga",
+		SpecificParam: map[string]interface{}{"timeoutMS": "1.5s"},
+	})
+	if err == nil {
+		t.Error("invalid timeoutMS must be reported")
+	}
+
+	// typoは無視せずエラーにする
+	_, err = New(exchange.Key{
+		APIKey:        "hoge",
+		APISecKey:     "fuga",
+		SpecificParam: map[string]interface{}{"timeoutMs": 1500},
+	})
+	if err == nil || !strings.Contains(err.Error(), "timeoutMs") {
+		t.Errorf("unknown key must be reported: %v", err)
+	}
+
+	// どちらが勝つかが実行毎に変わらないよう矛盾する指定はエラーにする
+	_, err = New(exchange.Key{
+		APIKey:        "hoge",
+		APISecKey:     "fuga",
+		SpecificParam: map[string]interface{}{"baseURL": "https://example.com", "testnet": true},
+	})
+	if err == nil {
+		t.Error("baseURL with testnet must be reported")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	order := []string{}
+	mw := func(name string) Middleware {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				order = append(order, name)
+				return next.RoundTrip(req)
+			})
+		}
+	}
+
+	ex, err := New(
+		exchange.Key{APIKey: "hoge", APISecKey: "fuga"},
+		WithTransport(fixtureTransport{"/v2/private/order/cancelAll": "order_cancel.json"}),
+		WithMiddleware(mw("outer"), mw("inner")),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ex.CancelAllOrder("BTCUSD"); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(order) != "[outer inner]" {
+		t.Errorf("order = %v", order)
+	}
+}
+
+func TestTimeSync(t *testing.T) {
+	local := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	server := local.Add(10 * time.Second)
+	var gotTimestamp, gotRecvWindow string
+
+	ex, err := New(
+		exchange.Key{APIKey: "hoge", APISecKey: "fuga"},
+		WithClock(func() time.Time { return local }),
+		WithTimeSync(time.Minute),
+		WithRecvWindow(3*time.Second),
+		WithTransport(RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if req.URL.Path == "/v2/public/time" {
+				return jsonResponse(req, http.StatusOK, fmt.Sprintf(
+					`{"ret_code":0,"ret_msg":"OK","result":{},"time_now":"%d.000000"}`, server.Unix(),
+				)), nil
+			}
+			gotTimestamp = req.URL.Query().Get("timestamp")
+			gotRecvWindow = req.URL.Query().Get("recv_window")
+			return jsonResponse(req, http.StatusOK, `{"ret_code":0,"ret_msg":"OK","result":{"data":[]}}`), nil
+		})),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ex.ActiveOrders("BTCUSD"); err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprint(server.UnixNano() / int64(time.Millisecond)); gotTimestamp != want {
+		t.Errorf("timestamp = %s, want %s", gotTimestamp, want)
+	}
+	if gotRecvWindow != "3000" {
+		t.Errorf("recv_window = %s", gotRecvWindow)
+	}
+}
+
+type recordLogger struct {
+	logs []Fields
+}
+
+func (r *recordLogger) Log(level LogLevel, msg string, fields Fields) {
+	r.logs = append(r.logs, fields)
+}
+
+func TestRedactSecrets(t *testing.T) {
+	logger := &recordLogger{}
+	ex, err := New(
+		exchange.Key{APIKey: "secret-api-key", APISecKey: "fuga"},
+		WithLogger(logger),
+		WithTransport(RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return nil, errors.New("connection reset")
+		})),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = ex.ActiveOrders("BTCUSD")
+	if err == nil {
+		t.Fatal("error expected")
+	}
+	if strings.Contains(err.Error(), "secret-api-key") || strings.Contains(err.Error(), "sign=") && !strings.Contains(err.Error(), "sign="+redacted) {
+		t.Errorf("secret leaked: %s", err)
+	}
+	if len(logger.logs) != 1 {
+		t.Fatalf("logs = %v", logger.logs)
+	}
+	if fmt.Sprint(logger.logs[0]["endpoint"]) != "/v2/private/order/list" {
+		t.Errorf("fields = %v", logger.logs[0])
+	}
+	if strings.Contains(fmt.Sprint(logger.logs[0]), "secret-api-key") {
+		t.Errorf("secret leaked: %v", logger.logs[0])
+	}
+}
@@ -0,0 +1,287 @@
+package bybit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/TTRSQ/bbwrapper/domains/base"
+	"github.com/TTRSQ/bbwrapper/domains/order"
+	"github.com/TTRSQ/bbwrapper/domains/order/id"
+	"github.com/TTRSQ/bbwrapper/interface/exchange"
+)
+
+func (bb *bybit) TriggerTypes() exchange.TriggerTypes {
+	return exchange.TriggerTypes{
+		LastPrice:  "LastPrice",
+		MarkPrice:  "MarkPrice",
+		IndexPrice: "IndexPrice",
+	}
+}
+
+// checkTriggerBy 空は取引所のデフォルトとして許す
+func (bb *bybit) checkTriggerBy(triggerBy string) error {
+	triggers := bb.TriggerTypes()
+	switch triggerBy {
+	case "", triggers.LastPrice, triggers.MarkPrice, triggers.IndexPrice:
+		return nil
+	}
+	return fmt.Errorf("bybit: unknown trigger type %q", triggerBy)
+}
+
+func (bb *bybit) CreateConditionalOrder(req order.ConditionalRequest) (*order.Responce, error) {
+	return bb.CreateConditionalOrderCtx(context.Background(), req)
+}
+
+// CreateConditionalOrderCtx OrderTypeがMarketならstop-market、Limitならstop-limit
+// 再送が重複したorder_link_idとして弾かれた場合は作成済みだがErrDuplicateClientIDを返す
+func (bb *bybit) CreateConditionalOrderCtx(ctx context.Context, req order.ConditionalRequest) (*order.Responce, error) {
+	if err := bb.validateCreateRequest(&req.CreateRequest); err != nil {
+		return nil, err
+	}
+	if req.StopPx <= 0 || req.BasePx <= 0 {
+		return nil, fmt.Errorf("bybit: stop price and base price must be positive: %v, %v", req.StopPx, req.BasePx)
+	}
+	if err := bb.checkTriggerBy(req.TriggerBy); err != nil {
+		return nil, err
+	}
+	if req.TriggerBy == "" {
+		req.TriggerBy = bb.TriggerTypes().LastPrice
+	}
+	if req.OrderLinkID == "" && bb.clientIDs != nil {
+		req.OrderLinkID = bb.clientIDs.Generate()
+	}
+
+	type Req struct {
+		Side           string  `json:"side"`
+		Symbol         string  `json:"symbol"`
+		OrderType      string  `json:"order_type"`
+		Qty            float64 `json:"qty"`
+		Price          float64 `json:"price,omitempty"`
+		BasePrice      float64 `json:"base_price"`
+		StopPx         float64 `json:"stop_px"`
+		TimeInForce    string  `json:"time_in_force"`
+		TriggerBy      string  `json:"trigger_by"`
+		ReduceOnly     bool    `json:"reduce_only,omitempty"`
+		CloseOnTrigger bool    `json:"close_on_trigger,omitempty"`
+		OrderLinkID    string  `json:"order_link_id,omitempty"`
+		TakeProfit     float64 `json:"take_profit,omitempty"`
+		StopLoss       float64 `json:"stop_loss,omitempty"`
+		TpTriggerBy    string  `json:"tp_trigger_by,omitempty"`
+		SlTriggerBy    string  `json:"sl_trigger_by,omitempty"`
+	}
+	res, err := bb.postRequest(ctx, "/v2/private/stop-order/create", structToMap(&Req{
+		Side:           map[bool]string{true: "Buy", false: "Sell"}[req.IsBuy],
+		Symbol:         req.Symbol,
+		OrderType:      req.OrderType,
+		Qty:            req.Size,
+		Price:          map[bool]float64{true: req.Price, false: 0}[req.OrderType == bb.OrderTypes().Limit],
+		BasePrice:      req.BasePx,
+		StopPx:         req.StopPx,
+		TimeInForce:    req.TimeInForce,
+		TriggerBy:      req.TriggerBy,
+		ReduceOnly:     req.ReduceOnly,
+		CloseOnTrigger: req.CloseOnTrigger,
+		OrderLinkID:    req.OrderLinkID,
+		TakeProfit:     req.TakeProfit,
+		StopLoss:       req.StopLoss,
+		TpTriggerBy:    req.TpTriggerBy,
+		SlTriggerBy:    req.SlTriggerBy,
+	}))
+	if err != nil {
+		return nil, err
+	}
+
+	// レスポンスの変換
+	type Res struct {
+		RetCode int    `json:"ret_code"`
+		RetMsg  string `json:"ret_msg"`
+		ExtCode string `json:"ext_code"`
+		ExtInfo string `json:"ext_info"`
+		Result  struct {
+			StopOrderID string `json:"stop_order_id"`
+			OrderLinkID string `json:"order_link_id"`
+		} `json:"result"`
+		TimeNow string `json:"time_now"`
+	}
+	resData := Res{}
+	if err := decode("/v2/private/stop-order/create", res, &resData); err != nil {
+		return nil, err
+	}
+
+	// トリガー前なので約定はない
+	return &order.Responce{
+		ID: id.NewID(bb.name, req.Symbol, resData.Result.StopOrderID).WithClientID(req.OrderLinkID),
+	}, nil
+}
+
+func (bb *bybit) EditConditionalOrder(symbol, localID string, price, size, stopPx float64) (*order.ConditionalOrder, error) {
+	return bb.EditConditionalOrderCtx(context.Background(), symbol, localID, price, size, stopPx)
+}
+
+// EditConditionalOrderCtx 0を渡した項目は変更しない
+func (bb *bybit) EditConditionalOrderCtx(ctx context.Context, symbol, localID string, price, size, stopPx float64) (*order.ConditionalOrder, error) {
+	// リクエスト
+	type Req struct {
+		StopOrderID  string  `json:"stop_order_id"`
+		Symbol       string  `json:"symbol"`
+		Qty          float64 `json:"p_r_qty,omitempty"`
+		Price        float64 `json:"p_r_price,omitempty"`
+		TriggerPrice float64 `json:"p_r_trigger_price,omitempty"`
+	}
+	res, err := bb.postRequest(ctx, "/v2/private/stop-order/replace", structToMap(&Req{
+		StopOrderID:  localID,
+		Symbol:       symbol,
+		Qty:          size,
+		Price:        price,
+		TriggerPrice: stopPx,
+	}))
+	if err != nil {
+		return nil, err
+	}
+
+	// レスポンスの変換
+	type Res struct {
+		RetCode int    `json:"ret_code"`
+		RetMsg  string `json:"ret_msg"`
+		ExtCode string `json:"ext_code"`
+		Result  struct {
+			StopOrderID string `json:"stop_order_id"`
+		} `json:"result"`
+		TimeNow number `json:"time_now"`
+	}
+	resData := Res{}
+	if err := decode("/v2/private/stop-order/replace", res, &resData); err != nil {
+		return nil, err
+	}
+	return &order.ConditionalOrder{
+		ID:            id.NewID(bb.name, symbol, resData.Result.StopOrderID),
+		UpdatedAtUnix: int(resData.TimeNow),
+	}, nil
+}
+
+func (bb *bybit) CancelConditionalOrder(symbol, localID string) error {
+	return bb.CancelConditionalOrderCtx(context.Background(), symbol, localID)
+}
+
+func (bb *bybit) CancelConditionalOrderCtx(ctx context.Context, symbol, localID string) error {
+	type Req struct {
+		Symbol      string `json:"symbol"`
+		StopOrderID string `json:"stop_order_id"`
+	}
+	res, err := bb.postRequest(ctx, "/v2/private/stop-order/cancel", structToMap(&Req{
+		Symbol:      symbol,
+		StopOrderID: localID,
+	}))
+	if err != nil {
+		return err
+	}
+
+	type Res struct {
+		RetCode int    `json:"ret_code"`
+		RetMsg  string `json:"ret_msg"`
+		ExtCode string `json:"ext_code"`
+		ExtInfo string `json:"ext_info"`
+		Result  struct {
+			StopOrderID string `json:"stop_order_id"`
+		} `json:"result"`
+		TimeNow string `json:"time_now"`
+	}
+	resData := Res{}
+	return decode("/v2/private/stop-order/cancel", res, &resData)
+}
+
+func (bb *bybit) CancelAllConditionalOrder(symbol string) error {
+	return bb.CancelAllConditionalOrderCtx(context.Background(), symbol)
+}
+
+func (bb *bybit) CancelAllConditionalOrderCtx(ctx context.Context, symbol string) error {
+	type Req struct {
+		Symbol string `json:"symbol"`
+	}
+
+	_, err := bb.postRequest(ctx, "/v2/private/stop-order/cancelAll", structToMap(&Req{
+		Symbol: symbol,
+	}))
+
+	return err
+}
+
+func (bb *bybit) ActiveConditionalOrders(symbol string) ([]order.ConditionalOrder, error) {
+	return bb.ActiveConditionalOrdersCtx(context.Background(), symbol)
+}
+
+func (bb *bybit) ActiveConditionalOrdersCtx(ctx context.Context, symbol string) ([]order.ConditionalOrder, error) {
+	type Req struct {
+		Symbol          string `json:"symbol"`
+		StopOrderStatus string `json:"stop_order_status"`
+	}
+	res, err := bb.getRequest(ctx, "/v2/private/stop-order/list", structToMap(&Req{
+		Symbol:          symbol,
+		StopOrderStatus: "Untriggered", // トリガー前のもののみ
+	}))
+	if err != nil {
+		return []order.ConditionalOrder{}, err
+	}
+	type Res struct {
+		RetCode int    `json:"ret_code"`
+		RetMsg  string `json:"ret_msg"`
+		ExtCode string `json:"ext_code"`
+		ExtInfo string `json:"ext_info"`
+		Result  struct {
+			Data []struct {
+				UserID          int       `json:"user_id"`
+				StopOrderStatus string    `json:"stop_order_status"`
+				Symbol          string    `json:"symbol"`
+				Side            string    `json:"side"`
+				OrderType       string    `json:"order_type"`
+				StopOrderType   string    `json:"stop_order_type"`
+				Price           number    `json:"price"`
+				Qty             number    `json:"qty"`
+				TimeInForce     string    `json:"time_in_force"`
+				BasePrice       number    `json:"base_price"`
+				StopPx          number    `json:"stop_px"`
+				TriggerBy       string    `json:"trigger_by"`
+				OrderLinkID     string    `json:"order_link_id"`
+				StopOrderID     string    `json:"stop_order_id"`
+				CreatedAt       time.Time `json:"created_at"`
+				UpdatedAt       time.Time `json:"updated_at"`
+			} `json:"data"`
+			Cursor string `json:"cursor"`
+		} `json:"result"`
+		TimeNow string `json:"time_now"`
+	}
+	resData := Res{}
+	if err := decode("/v2/private/stop-order/list", res, &resData); err != nil {
+		return []order.ConditionalOrder{}, err
+	}
+
+	orders := []order.ConditionalOrder{}
+	for _, v := range resData.Result.Data {
+		orders = append(orders, order.ConditionalOrder{
+			ID: id.NewID(bb.name, symbol, v.StopOrderID).WithClientID(v.OrderLinkID),
+			ConditionalRequest: order.ConditionalRequest{
+				CreateRequest: order.CreateRequest{
+					Request: order.Request{
+						Norm: base.Norm{
+							Price: float64(v.Price),
+							Size:  float64(v.Qty),
+						},
+						Symbol:    symbol,
+						IsBuy:     v.Side == "Buy",
+						OrderType: v.OrderType,
+					},
+					TimeInForce: v.TimeInForce,
+					OrderLinkID: v.OrderLinkID,
+				},
+				StopPx:    float64(v.StopPx),
+				BasePx:    float64(v.BasePrice),
+				TriggerBy: v.TriggerBy,
+			},
+			Status:        v.StopOrderStatus,
+			UpdatedAtUnix: int(v.UpdatedAt.Unix()),
+		})
+	}
+
+	return orders, nil
+}
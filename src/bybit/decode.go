@@ -0,0 +1,50 @@
+package bybit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// number float64 which accepts both json number and numeric string.
+// bybitは同じフィールドでもエンドポイントによって "8800.5" と 8800.5 を使い分けるため
+type number float64
+
+func (n *number) UnmarshalJSON(b []byte) error {
+	b = bytes.TrimSpace(b)
+	if bytes.Equal(b, []byte("null")) {
+		return nil
+	}
+	if len(b) > 0 && b[0] == '"' {
+		var s string
+		if err := json.Unmarshal(b, &s); err != nil {
+			return err
+		}
+		if s == "" {
+			*n = 0
+			return nil
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return fmt.Errorf("invalid numeric string %q", s)
+		}
+		*n = number(f)
+		return nil
+	}
+
+	var f float64
+	if err := json.Unmarshal(b, &f); err != nil {
+		return err
+	}
+	*n = number(f)
+	return nil
+}
+
+// decode unmarshal response body and report failure with endpoint.
+func decode(endpoint string, body []byte, v interface{}) error {
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("bybit: %s: decode response: %w", endpoint, err)
+	}
+	return nil
+}
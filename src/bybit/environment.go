@@ -0,0 +1,50 @@
+package bybit
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Environment bybit api environment.
+type Environment int
+
+const (
+	// Mainnet api.bybit.com
+	Mainnet Environment = iota
+	// MainnetBytick api.bytick.com (alternative domain of mainnet)
+	MainnetBytick
+	// Testnet api-testnet.bybit.com
+	Testnet
+)
+
+var restURLs = map[Environment]string{
+	Mainnet:       "https://api.bybit.com",
+	MainnetBytick: "https://api.bytick.com",
+	Testnet:       "https://api-testnet.bybit.com",
+}
+
+// parseBaseURL validate base url. httptestなどローカルの代替サーバー向けにhttpも許可する
+func parseBaseURL(rawURL string) (*url.URL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("bybit: invalid base url %q: %w", rawURL, err)
+	}
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return nil, fmt.Errorf("bybit: invalid base url %q: scheme must be http or https", rawURL)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("bybit: invalid base url %q: host required", rawURL)
+	}
+	u.Path = strings.TrimRight(u.Path, "/")
+	u.RawQuery = ""
+	u.Fragment = ""
+	return u, nil
+}
+
+// endpoint return full url of api path.
+func (bb *bybit) endpoint(path string) string {
+	u := *bb.baseURL
+	u.Path += path
+	return u.String()
+}
@@ -0,0 +1,93 @@
+package bybit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// errors.Isで判別するための代表的なエラー
+var (
+	ErrInsufficientBalance  = errors.New("bybit: insufficient balance")
+	ErrOrderNotFound        = errors.New("bybit: order not found")
+	ErrRateLimited          = errors.New("bybit: rate limited")
+	ErrInvalidSignature     = errors.New("bybit: invalid signature")
+	ErrTimestampOutOfWindow = errors.New("bybit: timestamp out of recv_window")
+	ErrReduceOnly           = errors.New("bybit: reduce-only rule not satisfied")
+	ErrDuplicateClientID    = errors.New("bybit: duplicate order_link_id")
+)
+
+// ret_code => sentinel error
+var retCodeErrors = map[int]error{
+	10002: ErrTimestampOutOfWindow, // request expired, check timestamp and recv_window
+	10004: ErrInvalidSignature,     // invalid sign
+	10006: ErrRateLimited,          // too many visits
+	10018: ErrRateLimited,          // exceeded the IP rate limit
+	20001: ErrOrderNotFound,        // order not exists or too late to cancel
+	30001: ErrDuplicateClientID,    // order_link_id is repeated
+	30032: ErrOrderNotFound,        // order has been filled or cancelled
+	30034: ErrOrderNotFound,        // no order found
+	30037: ErrOrderNotFound,        // order already cancelled
+	30031: ErrInsufficientBalance,  // insufficient available balance for order cost
+	30042: ErrInsufficientBalance,  // insufficient wallet balance
+	30049: ErrInsufficientBalance,  // insufficient available balance
+	30063: ErrReduceOnly,           // reduce-only rule not satisfied
+}
+
+// APIError error returned by bybit api.
+// HTTPステータスが2xx以外の場合はRetCodeが0のままHTTPStatusに値が入る
+type APIError struct {
+	RetCode    int
+	RetMsg     string
+	ExtCode    string
+	ExtInfo    string
+	HTTPStatus int
+	Endpoint   string
+}
+
+func (e *APIError) Error() string {
+	if e.RetCode == 0 {
+		return fmt.Sprintf("bybit: %s: http status %d: %s", e.Endpoint, e.HTTPStatus, e.RetMsg)
+	}
+	return fmt.Sprintf("bybit: %s: ret_code %d: %s (ext_code: %q, ext_info: %q)", e.Endpoint, e.RetCode, e.RetMsg, e.ExtCode, e.ExtInfo)
+}
+
+// Is make errors.Is(err, ErrXXX) work.
+func (e *APIError) Is(target error) bool {
+	if sentinel, ok := retCodeErrors[e.RetCode]; ok && sentinel == target {
+		return true
+	}
+	// IP制限に引っかかった場合は403が返る
+	limited := e.HTTPStatus == http.StatusForbidden || e.HTTPStatus == http.StatusTooManyRequests
+	return target == ErrRateLimited && e.RetCode == 0 && limited
+}
+
+// apiStatus common fields of every response.
+type apiStatus struct {
+	RetCode int    `json:"ret_code"`
+	RetMsg  string `json:"ret_msg"`
+	ExtCode string `json:"ext_code"`
+	ExtInfo string `json:"ext_info"`
+}
+
+func (s apiStatus) toError(endpoint string, httpStatus int) *APIError {
+	return &APIError{
+		RetCode:    s.RetCode,
+		RetMsg:     s.RetMsg,
+		ExtCode:    s.ExtCode,
+		ExtInfo:    s.ExtInfo,
+		HTTPStatus: httpStatus,
+		Endpoint:   endpoint,
+	}
+}
+
+// newAPIError make APIError from non 2xx response.
+func newAPIError(endpoint string, httpStatus int, body []byte) *APIError {
+	status := apiStatus{}
+	if err := json.Unmarshal(body, &status); err != nil || status.RetMsg == "" {
+		status = apiStatus{RetMsg: strings.TrimSpace(string(body))}
+	}
+	return status.toError(endpoint, httpStatus)
+}
@@ -0,0 +1,182 @@
+package bybit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/TTRSQ/bbwrapper/domains/kline"
+)
+
+// klineIntervals intervals accepted by kline apis. 数字は分
+var klineIntervals = map[string]bool{
+	"1": true, "3": true, "5": true, "15": true, "30": true,
+	"60": true, "120": true, "240": true, "360": true, "720": true,
+	"D": true, "W": true, "M": true,
+}
+
+// klinePaths endpoint of each price type.
+var klinePaths = map[kline.PriceType]string{
+	kline.PriceTrade:        "/v2/public/kline/list",
+	kline.PriceMark:         "/v2/public/mark-price-kline",
+	kline.PriceIndex:        "/v2/public/index-price-kline",
+	kline.PricePremiumIndex: "/v2/public/premium-index-kline",
+}
+
+func (bb *bybit) Klines(symbol, interval string, from time.Time, limit int, priceType kline.PriceType) ([]kline.Kline, error) {
+	return bb.KlinesCtx(context.Background(), symbol, interval, from, limit, priceType)
+}
+
+func (bb *bybit) KlinesCtx(ctx context.Context, symbol, interval string, from time.Time, limit int, priceType kline.PriceType) ([]kline.Kline, error) {
+	path, ok := klinePaths[priceType]
+	if !ok {
+		return []kline.Kline{}, fmt.Errorf("bybit: unknown kline price type %d", priceType)
+	}
+	if !klineIntervals[interval] {
+		return []kline.Kline{}, fmt.Errorf("bybit: unknown kline interval %q", interval)
+	}
+
+	// リクエスト
+	type Req struct {
+		Symbol   string `json:"symbol"`
+		Interval string `json:"interval"`
+		From     string `json:"from"`
+		Limit    string `json:"limit"`
+	}
+	res, err := bb.getRequest(ctx, path, structToMap(&Req{
+		Symbol:   symbol,
+		Interval: interval,
+		From:     fmt.Sprint(from.Unix()),
+		Limit:    fmt.Sprint(limit),
+	}))
+	if err != nil {
+		return []kline.Kline{}, err
+	}
+
+	// レスポンスの変換 価格の種類によって開始時刻のフィールド名が違う
+	type Res struct {
+		RetCode int    `json:"ret_code"`
+		RetMsg  string `json:"ret_msg"`
+		ExtCode string `json:"ext_code"`
+		ExtInfo string `json:"ext_info"`
+		Result  []struct {
+			Symbol   string `json:"symbol"`
+			Interval string `json:"interval"`
+			Period   string `json:"period"`
+			OpenTime number `json:"open_time"`
+			StartAt  number `json:"start_at"`
+			Open     number `json:"open"`
+			High     number `json:"high"`
+			Low      number `json:"low"`
+			Close    number `json:"close"`
+			Volume   number `json:"volume"`
+			Turnover number `json:"turnover"`
+		} `json:"result"`
+		TimeNow string `json:"time_now"`
+	}
+	resData := Res{}
+	if err := decode(path, res, &resData); err != nil {
+		return []kline.Kline{}, err
+	}
+
+	ret := []kline.Kline{}
+	for i := range resData.Result {
+		item := resData.Result[i]
+		openTime := item.OpenTime
+		if openTime == 0 {
+			openTime = item.StartAt
+		}
+		openAt := time.Unix(int64(openTime), 0)
+		ret = append(ret, kline.Kline{
+			Symbol:   item.Symbol,
+			Interval: interval,
+			OpenTime: openAt,
+			Open:     float64(item.Open),
+			High:     float64(item.High),
+			Low:      float64(item.Low),
+			Close:    float64(item.Close),
+			Volume:   float64(item.Volume),
+			Turnover: float64(item.Turnover),
+			// 終了時刻を過ぎた足は確定している
+			Confirmed: !openAt.Add(klineDuration(interval)).After(bb.now()),
+		})
+	}
+
+	return ret, nil
+}
+
+// klineDuration length of interval. "M"は31日として扱う
+func klineDuration(interval string) time.Duration {
+	switch interval {
+	case "D":
+		return 24 * time.Hour
+	case "W":
+		return 7 * 24 * time.Hour
+	case "M":
+		return 31 * 24 * time.Hour
+	}
+	minute := 0
+	fmt.Sscan(interval, &minute)
+	return time.Duration(minute) * time.Minute
+}
+
+// KlineEvent update of kline. 確定前の足も随時届く
+type KlineEvent struct {
+	Topic string
+	kline.Kline
+}
+
+func (e KlineEvent) EventTopic() string {
+	return e.Topic
+}
+
+// wsKline item of klineV2 topic.
+type wsKline struct {
+	Start    number `json:"start"`
+	End      number `json:"end"`
+	Open     number `json:"open"`
+	Close    number `json:"close"`
+	High     number `json:"high"`
+	Low      number `json:"low"`
+	Volume   number `json:"volume"`
+	Turnover number `json:"turnover"`
+	Confirm  bool   `json:"confirm"`
+}
+
+// SubscribeKlines subscribe trade price klines of symbol. intervalはKlinesと同じ
+func SubscribeKlines(ctx context.Context, symbol, interval string, opts ...StreamOption) (*Subscription, error) {
+	if !klineIntervals[interval] {
+		return nil, fmt.Errorf("bybit: unknown kline interval %q", interval)
+	}
+
+	return subscribe(ctx, opts, []string{"klineV2." + interval + "." + symbol}, klineDecoder(symbol, interval))
+}
+
+func klineDecoder(symbol, interval string) func(frame wsFrame) ([]Event, error) {
+	return func(frame wsFrame) ([]Event, error) {
+		items := []wsKline{}
+		if err := json.Unmarshal(frame.Data, &items); err != nil {
+			return nil, fmt.Errorf("bybit: decode kline: %w", err)
+		}
+		events := make([]Event, len(items))
+		for i, item := range items {
+			events[i] = KlineEvent{
+				Topic: frame.Topic,
+				Kline: kline.Kline{
+					Symbol:    symbol,
+					Interval:  interval,
+					OpenTime:  time.Unix(int64(item.Start), 0),
+					Open:      float64(item.Open),
+					High:      float64(item.High),
+					Low:       float64(item.Low),
+					Close:     float64(item.Close),
+					Volume:    float64(item.Volume),
+					Turnover:  float64(item.Turnover),
+					Confirmed: item.Confirm,
+				},
+			}
+		}
+		return events, nil
+	}
+}
@@ -0,0 +1,118 @@
+package bybit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/TTRSQ/bbwrapper/domains/base"
+	"github.com/TTRSQ/bbwrapper/domains/liquidation"
+)
+
+func (bb *bybit) Liquidations(symbol string, from time.Time, limit int) ([]liquidation.Liquidation, error) {
+	return bb.LiquidationsCtx(context.Background(), symbol, from, limit)
+}
+
+func (bb *bybit) LiquidationsCtx(ctx context.Context, symbol string, from time.Time, limit int) ([]liquidation.Liquidation, error) {
+	// リクエスト
+	type Req struct {
+		Symbol    string `json:"symbol"`
+		StartTime string `json:"start_time"`
+		Limit     string `json:"limit"`
+	}
+	res, err := bb.getRequest(ctx, "/v2/public/liq-records", structToMap(&Req{
+		Symbol:    symbol,
+		StartTime: fmt.Sprint(from.UnixNano() / int64(time.Millisecond)),
+		Limit:     fmt.Sprint(limit),
+	}))
+	if err != nil {
+		return []liquidation.Liquidation{}, err
+	}
+
+	// レスポンスの変換
+	type Res struct {
+		RetCode int             `json:"ret_code"`
+		RetMsg  string          `json:"ret_msg"`
+		ExtCode string          `json:"ext_code"`
+		ExtInfo string          `json:"ext_info"`
+		Result  []wsLiquidation `json:"result"`
+		TimeNow string          `json:"time_now"`
+	}
+	resData := Res{}
+	if err := decode("/v2/public/liq-records", res, &resData); err != nil {
+		return []liquidation.Liquidation{}, err
+	}
+
+	ret := []liquidation.Liquidation{}
+	for i := range resData.Result {
+		item := resData.Result[i]
+		if item.Symbol == "" {
+			item.Symbol = symbol
+		}
+		ret = append(ret, item.liquidation())
+	}
+
+	return ret, nil
+}
+
+// LiquidationEvent forced liquidation.
+type LiquidationEvent struct {
+	Topic string
+	liquidation.Liquidation
+}
+
+func (e LiquidationEvent) EventTopic() string {
+	return e.Topic
+}
+
+// wsLiquidation item of liquidation topic. REST(liq-records)も同じ形で返る
+type wsLiquidation struct {
+	Symbol string `json:"symbol"`
+	Side   string `json:"side"`
+	Price  number `json:"price"`
+	Qty    number `json:"qty"`
+	Time   number `json:"time"`
+}
+
+func (l wsLiquidation) liquidation() liquidation.Liquidation {
+	return liquidation.Liquidation{
+		Symbol: l.Symbol,
+		Norm: base.Norm{
+			Price: float64(l.Price),
+			Size:  float64(l.Qty),
+		},
+		IsBuy:     l.Side == "Buy",
+		OccuredAt: msToTime(int64(l.Time)),
+	}
+}
+
+// SubscribeLiquidations subscribe forced liquidations of symbol.
+func SubscribeLiquidations(ctx context.Context, symbol string, opts ...StreamOption) (*Subscription, error) {
+	return subscribe(ctx, opts, []string{"liquidation." + symbol}, decodeLiquidationEvents)
+}
+
+func decodeLiquidationEvents(frame wsFrame) ([]Event, error) {
+	items, err := decodeLiquidations(frame.Data)
+	if err != nil {
+		return nil, err
+	}
+	events := make([]Event, len(items))
+	for i, item := range items {
+		events[i] = LiquidationEvent{Topic: frame.Topic, Liquidation: item.liquidation()}
+	}
+	return events, nil
+}
+
+// decodeLiquidations dataは1件ずつのobjectで届くが配列にも対応する
+func decodeLiquidations(data json.RawMessage) ([]wsLiquidation, error) {
+	items := []wsLiquidation{}
+	if err := json.Unmarshal(data, &items); err == nil {
+		return items, nil
+	}
+	item := wsLiquidation{}
+	if err := json.Unmarshal(data, &item); err != nil {
+		return nil, fmt.Errorf("bybit: decode liquidation: %w", err)
+	}
+	return []wsLiquidation{item}, nil
+}
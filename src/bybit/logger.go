@@ -0,0 +1,127 @@
+package bybit
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// LogLevel level of log.
+type LogLevel int
+
+const (
+	LogDebug LogLevel = iota
+	LogInfo
+	LogWarn
+	LogError
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LogDebug:
+		return "DEBUG"
+	case LogInfo:
+		return "INFO"
+	case LogWarn:
+		return "WARN"
+	case LogError:
+		return "ERROR"
+	}
+	return fmt.Sprintf("LogLevel(%d)", int(l))
+}
+
+// Fields structured fields of log (endpoint, latency, ret_code...).
+type Fields map[string]interface{}
+
+// Logger pluggable logger. api_key, signなどの秘匿値はライブラリ側で伏せてから渡す
+type Logger interface {
+	Log(level LogLevel, msg string, fields Fields)
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Log(level LogLevel, msg string, fields Fields) {}
+
+type stdLogger struct {
+	logger *log.Logger
+	min    LogLevel
+}
+
+// NewStdLogger return Logger which writes logs of min level or higher to l.
+func NewStdLogger(l *log.Logger, min LogLevel) Logger {
+	return &stdLogger{logger: l, min: min}
+}
+
+func (s *stdLogger) Log(level LogLevel, msg string, fields Fields) {
+	if level < s.min {
+		return
+	}
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	line := level.String() + " " + msg
+	for _, k := range keys {
+		line += fmt.Sprintf(" %s=%v", k, fields[k])
+	}
+	s.logger.Println(line)
+}
+
+// 値を伏せるパラメータ
+var secretParams = map[string]bool{
+	"api_key": true,
+	"sign":    true,
+	"secret":  true,
+}
+
+const redacted = "REDACTED"
+
+// redactURL return url string with secret query params masked.
+func redactURL(u *url.URL) string {
+	masked := *u
+	query := masked.Query()
+	for k := range query {
+		if secretParams[strings.ToLower(k)] {
+			query.Set(k, redacted)
+		}
+	}
+	masked.RawQuery = query.Encode()
+	return masked.String()
+}
+
+// logRequest write result of api request.
+func (bb *bybit) logRequest(req *http.Request, status int, latency time.Duration, err error) {
+	fields := Fields{
+		"method":   req.Method,
+		"endpoint": req.URL.Path,
+		"latency":  latency,
+	}
+	if status != 0 {
+		fields["http_status"] = status
+	}
+	if limit, ok := bb.rateLimiter.status()[rateLimitGroup(req.URL.Path)]; ok {
+		fields["rate_limit_remaining"] = limit.Remaining
+	}
+
+	if err == nil {
+		fields["ret_code"] = 0
+		bb.logger.Log(LogDebug, "bybit request", fields)
+		return
+	}
+
+	fields["error"] = err.Error()
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		fields["ret_code"] = apiErr.RetCode
+		bb.logger.Log(LogWarn, "bybit request failed", fields)
+		return
+	}
+	bb.logger.Log(LogError, "bybit request failed", fields)
+}
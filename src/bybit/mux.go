@@ -0,0 +1,422 @@
+package bybit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TTRSQ/bbwrapper/interface/exchange"
+)
+
+// defaultMaxTopics topics per connection of Mux. bybitの接続毎の購読数制限に合わせて変更できる
+const defaultMaxTopics = 10
+
+// WithMaxTopicsPerConn set max topics subscribed on one connection of Mux. default: 10
+func WithMaxTopicsPerConn(n int) StreamOption {
+	return func(c *streamConfig) error {
+		if n <= 0 {
+			return fmt.Errorf("bybit: max topics per connection must be positive: %d", n)
+		}
+		c.maxTopics = n
+		return nil
+	}
+}
+
+// Mux share websocket connections among many subscriptions.
+// topicは購読者がいる間だけ購読し、1接続あたりの上限を超えると接続を増やす
+type Mux struct {
+	opts []StreamOption
+
+	mu     sync.Mutex
+	config *streamConfig
+	shards []*muxShard
+	topics map[string]*muxTopic
+	subs   map[*Subscription]bool
+	closed bool
+}
+
+type muxShard struct {
+	conn    *wsConn
+	topics  int
+	retired bool
+}
+
+type muxTopic struct {
+	shard  *muxShard
+	decode func(frame wsFrame) ([]Event, error)
+	subs   map[*Subscription]bool
+}
+
+// NewMux return Mux. optsは全ての接続と購読に適用される
+// 遅い購読者が同じ接続の他のtopicを止めないよう、backpressureの既定はBackpressureDropOldest
+func NewMux(opts ...StreamOption) (*Mux, error) {
+	opts = append([]StreamOption{WithBackpressure(BackpressureDropOldest)}, opts...)
+	config, err := newStreamConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	if config.maxTopics == 0 {
+		config.maxTopics = defaultMaxTopics
+	}
+	return &Mux{
+		opts:   opts,
+		config: config,
+		topics: map[string]*muxTopic{},
+		subs:   map[*Subscription]bool{},
+	}, nil
+}
+
+// Subscribe subscribe topics (e.g. "trade.BTCUSD", "orderBookL2_25.ETHUSD").
+// 対応するtopicはtrade, orderBookL2_25, orderBook_200.100ms, instrument_info.100ms, klineV2, liquidation
+// optsでbuffer sizeやbackpressureを購読毎に変えられる
+func (m *Mux) Subscribe(ctx context.Context, topics []string, opts ...StreamOption) (*Subscription, error) {
+	if len(topics) == 0 {
+		return nil, errors.New("bybit: no topic to subscribe")
+	}
+	// 途中まで購読してから失敗しないよう先にtopicを検証する
+	decoders := make([]func(frame wsFrame) ([]Event, error), len(topics))
+	for i, topic := range topics {
+		decode, err := newTopicDecoder(topic)
+		if err != nil {
+			return nil, err
+		}
+		decoders[i] = decode
+	}
+	config, err := newStreamConfig(append(append([]StreamOption{}, m.opts...), opts...))
+	if err != nil {
+		return nil, err
+	}
+	s := newSubscriptionOf(config)
+	s.stop = func() {
+		m.release(s)
+		s.finish()
+	}
+
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil, errStreamClosed
+	}
+	m.subs[s] = true
+	m.mu.Unlock()
+
+	for i, topic := range topics {
+		if err := m.acquire(s, topic, decoders[i]); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+
+	s.send(StatusEvent{exchange.StreamEvent{Type: exchange.StreamConnected, At: time.Now()}})
+	s.watch(ctx)
+	return s, nil
+}
+
+// acquire add subscriber to topic, subscribe topic if it is new.
+// 接続を増やす場合、dialの間も他の接続の配信を止めないようlockの外で接続する
+func (m *Mux) acquire(s *Subscription, topic string, decode func(frame wsFrame) ([]Event, error)) error {
+	for {
+		m.mu.Lock()
+		if m.closed || !m.subs[s] {
+			m.mu.Unlock()
+			return errStreamClosed
+		}
+		if t, ok := m.topics[topic]; ok {
+			t.subs[s] = true
+			m.mu.Unlock()
+			return nil
+		}
+		if shard := m.shardWithRoomLocked(); shard != nil {
+			m.topics[topic] = &muxTopic{
+				shard:  shard,
+				decode: decode,
+				subs:   map[*Subscription]bool{s: true},
+			}
+			shard.topics++
+			shard.conn.subscribe([]string{topic})
+			m.mu.Unlock()
+			return nil
+		}
+		m.mu.Unlock()
+
+		shard, err := m.dialShard()
+		if err != nil {
+			return err
+		}
+		m.mu.Lock()
+		if m.closed {
+			m.mu.Unlock()
+			shard.conn.close()
+			return errStreamClosed
+		}
+		if m.shardWithRoomLocked() != nil {
+			// 同時に接続した他の購読が先に空きのある接続を追加した. 空の接続を残さずに閉じる
+			m.mu.Unlock()
+			shard.conn.close()
+			continue
+		}
+		m.shards = append(m.shards, shard)
+		m.mu.Unlock()
+		go m.forwardStatus(shard)
+	}
+}
+
+// shardWithRoomLocked return connection which has room for topic. lockを取った状態で呼ぶ
+func (m *Mux) shardWithRoomLocked() *muxShard {
+	for _, shard := range m.shards {
+		if shard.topics < m.config.maxTopics {
+			return shard
+		}
+	}
+	return nil
+}
+
+// dialShard connect new connection without topics. lockを取らずに呼ぶ
+func (m *Mux) dialShard() (*muxShard, error) {
+	shard := &muxShard{}
+	shard.conn = newWSConn(m.config, nil, func(frame wsFrame) error {
+		return m.dispatch(shard, frame)
+	})
+	// 切断中の差分は受け取れないので、この接続のtopicの状態(板など)を作り直す
+	shard.conn.onDisconnect = func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		for topic, t := range m.topics {
+			if t.shard == shard {
+				t.decode, _ = newTopicDecoder(topic)
+			}
+		}
+	}
+	// 拒否されたtopicの購読者だけを終了し、同じ接続の他のtopicは配り続ける
+	shard.conn.onTopicError = func(op string, topics []string, err error) {
+		if op == "subscribe" {
+			m.reject(shard, topics, err)
+		}
+	}
+	if err := shard.conn.start(); err != nil {
+		return nil, err
+	}
+	return shard, nil
+}
+
+// reject remove topics rejected by bybit and stop their subscribers.
+func (m *Mux) reject(shard *muxShard, topics []string, err error) {
+	shard.conn.forget(topics)
+
+	m.mu.Lock()
+	subs := []*Subscription{}
+	for _, topic := range topics {
+		t, ok := m.topics[topic]
+		if !ok || t.shard != shard {
+			continue
+		}
+		delete(m.topics, topic)
+		shard.topics--
+		for s := range t.subs {
+			subs = append(subs, s)
+		}
+	}
+	idle := shard.topics == 0 && !shard.retired
+	if idle {
+		m.removeShardLocked(shard)
+	}
+	m.mu.Unlock()
+
+	for _, s := range subs {
+		s.setErr(err)
+		go s.Close()
+	}
+	if idle {
+		// handlerのgoroutineから呼ばれるので終了を待たずに閉じる
+		go shard.conn.close()
+	}
+}
+
+// dispatch decode frame once and fan out events to subscribers of topic.
+// BackpressureBlockの購読者が詰まると同じ接続の全topicの受信が止まる. 接続を閉じると配信を諦める
+func (m *Mux) dispatch(shard *muxShard, frame wsFrame) error {
+	m.mu.Lock()
+	t, ok := m.topics[frame.Topic]
+	if !ok {
+		// unsubscribe済み
+		m.mu.Unlock()
+		return nil
+	}
+	events, err := t.decode(frame)
+	subs := make([]*Subscription, 0, len(t.subs))
+	for s := range t.subs {
+		subs = append(subs, s)
+	}
+	m.mu.Unlock()
+
+	for _, s := range subs {
+		for _, e := range events {
+			if err := s.sendUntil(e, shard.conn.closeCh); err != nil {
+				// 遅い購読者だけを終了して他の購読者には配り続ける
+				if errors.Is(err, ErrSlowConsumer) {
+					s.setErr(err)
+					go s.Close()
+				}
+				break
+			}
+		}
+	}
+	return err
+}
+
+// forwardStatus fan out connection events to subscribers of shard until the connection stops.
+func (m *Mux) forwardStatus(shard *muxShard) {
+	for e := range shard.conn.events {
+		for _, s := range m.subscribersOf(shard) {
+			if err := s.send(StatusEvent{e}); errors.Is(err, ErrSlowConsumer) {
+				s.setErr(err)
+				go s.Close()
+			}
+		}
+	}
+
+	m.mu.Lock()
+	if shard.retired {
+		m.mu.Unlock()
+		return
+	}
+	// 再接続できずに止まった接続のtopicを持つ購読は終了する
+	subs := m.subscribersOfLocked(shard)
+	m.removeShardLocked(shard)
+	for topic, t := range m.topics {
+		if t.shard == shard {
+			delete(m.topics, topic)
+		}
+	}
+	m.mu.Unlock()
+
+	err := shard.conn.lastErr()
+	if err == nil {
+		err = errStreamClosed
+	}
+	for _, s := range subs {
+		s.setErr(err)
+		go s.Close()
+	}
+}
+
+func (m *Mux) subscribersOf(shard *muxShard) []*Subscription {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.subscribersOfLocked(shard)
+}
+
+func (m *Mux) subscribersOfLocked(shard *muxShard) []*Subscription {
+	seen := map[*Subscription]bool{}
+	subs := []*Subscription{}
+	for _, t := range m.topics {
+		if t.shard != shard {
+			continue
+		}
+		for s := range t.subs {
+			if !seen[s] {
+				seen[s] = true
+				subs = append(subs, s)
+			}
+		}
+	}
+	return subs
+}
+
+// release remove subscriber from its topics and unsubscribe topics nobody needs.
+// 購読するtopicがなくなった接続は閉じる
+func (m *Mux) release(s *Subscription) {
+	m.mu.Lock()
+	delete(m.subs, s)
+	idle := []*muxShard{}
+	for topic, t := range m.topics {
+		if !t.subs[s] {
+			continue
+		}
+		delete(t.subs, s)
+		if len(t.subs) > 0 {
+			continue
+		}
+		delete(m.topics, topic)
+		t.shard.topics--
+		t.shard.conn.unsubscribe([]string{topic})
+		if t.shard.topics == 0 {
+			idle = append(idle, t.shard)
+		}
+	}
+	for _, shard := range idle {
+		m.removeShardLocked(shard)
+	}
+	m.mu.Unlock()
+
+	// handlerがlockを待っている場合があるのでlockの外で閉じる. 詰まった配信はcloseChで止まる
+	for _, shard := range idle {
+		shard.conn.close()
+	}
+}
+
+// removeShardLocked lockを取った状態で呼ぶ
+func (m *Mux) removeShardLocked(shard *muxShard) {
+	shard.retired = true
+	for i, v := range m.shards {
+		if v == shard {
+			m.shards = append(m.shards[:i], m.shards[i+1:]...)
+			return
+		}
+	}
+}
+
+// Close stop all subscriptions and connections.
+func (m *Mux) Close() error {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil
+	}
+	m.closed = true
+	subs := make([]*Subscription, 0, len(m.subs))
+	for s := range m.subs {
+		subs = append(subs, s)
+	}
+	m.mu.Unlock()
+
+	// 最後の購読が終わると接続も閉じられる
+	for _, s := range subs {
+		s.Close()
+	}
+
+	// topicを持たないまま残った接続
+	m.mu.Lock()
+	shards := append([]*muxShard{}, m.shards...)
+	for _, shard := range shards {
+		m.removeShardLocked(shard)
+	}
+	m.mu.Unlock()
+	for _, shard := range shards {
+		shard.conn.close()
+	}
+	return nil
+}
+
+// newTopicDecoder return decoder of topic. 板などの状態を持つtopicは呼ぶ度に新しい状態から始まる
+func newTopicDecoder(topic string) (func(frame wsFrame) ([]Event, error), error) {
+	parts := strings.Split(topic, ".")
+	symbol := parts[len(parts)-1]
+	switch {
+	case len(parts) == 2 && parts[0] == "trade":
+		return decodeTradeEvents, nil
+	case len(parts) == 2 && parts[0] == "liquidation":
+		return decodeLiquidationEvents, nil
+	case len(parts) == 3 && parts[0] == "klineV2" && klineIntervals[parts[1]]:
+		return klineDecoder(symbol, parts[1]), nil
+	case len(parts) == 3 && parts[0] == "instrument_info" && parts[1] == "100ms":
+		return (&tickerDecoder{}).decode, nil
+	case topic == orderBookTopic(25, symbol), topic == orderBookTopic(200, symbol):
+		b := &OrderBook{symbol: symbol, levels: map[int64]bookLevel{}}
+		return b.handle, nil
+	}
+	return nil, fmt.Errorf("bybit: topic %q is not supported by Mux", topic)
+}
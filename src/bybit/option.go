@@ -0,0 +1,287 @@
+package bybit
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TTRSQ/bbwrapper/domains/order/id"
+)
+
+// Option optional setting of bybit client.
+type Option func(bb *bybit) error
+
+// WithRateLimitPolicy set behavior when rate limit quota is used up. default: RateLimitTrackOnly
+func WithRateLimitPolicy(policy RateLimitPolicy) Option {
+	return func(bb *bybit) error {
+		bb.rateLimiter.policy = policy
+		return nil
+	}
+}
+
+// WithRetryPolicy set retry policy of api requests. default: no retry
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(bb *bybit) error {
+		bb.retryPolicy = policy
+		return nil
+	}
+}
+
+// WithEnvironment select mainnet or testnet. default: Mainnet
+func WithEnvironment(env Environment) Option {
+	return func(bb *bybit) error {
+		rawURL, ok := restURLs[env]
+		if !ok {
+			return fmt.Errorf("bybit: unknown environment %d", env)
+		}
+		u, err := parseBaseURL(rawURL)
+		if err != nil {
+			return err
+		}
+		bb.baseURL = u
+		return nil
+	}
+}
+
+// WithBaseURL set arbitrary api base url (e.g. "http://127.0.0.1:8080" for local fake server).
+func WithBaseURL(rawURL string) Option {
+	return func(bb *bybit) error {
+		u, err := parseBaseURL(rawURL)
+		if err != nil {
+			return err
+		}
+		bb.baseURL = u
+		return nil
+	}
+}
+
+// WithTimeout set timeout of each http request.
+func WithTimeout(timeout time.Duration) Option {
+	return func(bb *bybit) error {
+		if timeout < 0 {
+			return fmt.Errorf("bybit: timeout must not be negative: %s", timeout)
+		}
+		bb.timeout = timeout
+		return nil
+	}
+}
+
+// WithHTTPClient use given http client. WithTimeoutと併用した場合はコピーにTimeoutを設定する
+func WithHTTPClient(client *http.Client) Option {
+	return func(bb *bybit) error {
+		if client == nil {
+			return fmt.Errorf("bybit: http client must not be nil")
+		}
+		bb.httpClient = client
+		return nil
+	}
+}
+
+// WithTransport use given RoundTripper (proxy, tls config, connection pool...).
+func WithTransport(rt http.RoundTripper) Option {
+	return func(bb *bybit) error {
+		if rt == nil {
+			return fmt.Errorf("bybit: transport must not be nil")
+		}
+		bb.transport = rt
+		return nil
+	}
+}
+
+// WithMiddleware add middlewares wrapping every api request. 先に登録したものが外側になる
+func WithMiddleware(mws ...Middleware) Option {
+	return func(bb *bybit) error {
+		for _, mw := range mws {
+			if mw == nil {
+				return fmt.Errorf("bybit: middleware must not be nil")
+			}
+		}
+		bb.middlewares = append(bb.middlewares, mws...)
+		return nil
+	}
+}
+
+// WithRecvWindow set recv_window of signed requests. 0なら送らない (取引所側のデフォルト5秒)
+func WithRecvWindow(window time.Duration) Option {
+	return func(bb *bybit) error {
+		if window < 0 {
+			return fmt.Errorf("bybit: recv_window must not be negative: %s", window)
+		}
+		bb.recvWindow = window
+		return nil
+	}
+}
+
+// WithTimeSync measure offset from bybit server time (/v2/public/time) every interval
+// and apply it to timestamp of signed requests. request expiredエラーの後は次のリクエスト前に再同期する
+func WithTimeSync(interval time.Duration) Option {
+	return func(bb *bybit) error {
+		if interval <= 0 {
+			return fmt.Errorf("bybit: time sync interval must be positive: %s", interval)
+		}
+		bb.clock.interval = interval
+		return nil
+	}
+}
+
+// WithLogger set logger of api requests. default: no log
+func WithLogger(logger Logger) Option {
+	return func(bb *bybit) error {
+		if logger == nil {
+			return fmt.Errorf("bybit: logger must not be nil")
+		}
+		bb.logger = logger
+		return nil
+	}
+}
+
+// WithClock replace time.Now used for request timestamp and rate limit.
+func WithClock(now func() time.Time) Option {
+	return func(bb *bybit) error {
+		if now == nil {
+			return fmt.Errorf("bybit: clock must not be nil")
+		}
+		bb.now = now
+		return nil
+	}
+}
+
+// WithClientIDGenerator set order_link_id of orders created without it (e.g. id.NewTagGenerator("mm")).
+func WithClientIDGenerator(g id.Generator) Option {
+	return func(bb *bybit) error {
+		if g == nil {
+			return fmt.Errorf("bybit: client id generator must not be nil")
+		}
+		bb.clientIDs = g
+		return nil
+	}
+}
+
+// WithCloseOnTrigger add close_on_trigger to LiquidationOrder. 証拠金不足でも他の注文を取り消して決済する
+func WithCloseOnTrigger(enabled bool) Option {
+	return func(bb *bybit) error {
+		bb.closeOnTrigger = enabled
+		return nil
+	}
+}
+
+// specificParamKeys keys of SpecificParam in the order they are applied.
+var specificParamKeys = []string{"timeoutMS", "recvWindowMS", "baseURL", "testnet"}
+
+// specificParamOptions convert exchange.Key.SpecificParam to options.
+// 型が合わない場合、知らないkeyがある場合はpanicせずにエラーを返す
+// baseURLとtestnet: trueは接続先が矛盾するので同時に指定できない
+//
+//	timeoutMS    : 数値 (ミリ秒)
+//	recvWindowMS : 数値 (ミリ秒)
+//	baseURL      : string
+//	testnet      : bool
+func specificParamOptions(param map[string]interface{}) ([]Option, error) {
+	for key := range param {
+		known := false
+		for _, k := range specificParamKeys {
+			known = known || k == key
+		}
+		if !known {
+			return nil, fmt.Errorf("bybit: unknown SpecificParam key %q (accepted: %s)", key, strings.Join(specificParamKeys, ", "))
+		}
+	}
+
+	opts := []Option{}
+	for _, key := range specificParamKeys {
+		value, ok := param[key]
+		if !ok {
+			continue
+		}
+		switch key {
+		case "timeoutMS":
+			ms, err := toInt64(key, value)
+			if err != nil {
+				return nil, err
+			}
+			opts = append(opts, WithTimeout(time.Duration(ms)*time.Millisecond))
+		case "recvWindowMS":
+			ms, err := toInt64(key, value)
+			if err != nil {
+				return nil, err
+			}
+			opts = append(opts, WithRecvWindow(time.Duration(ms)*time.Millisecond))
+		case "baseURL":
+			rawURL, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("bybit: SpecificParam[%q] must be string, got %T", key, value)
+			}
+			opts = append(opts, WithBaseURL(rawURL))
+		case "testnet":
+			testnet, ok := value.(bool)
+			if !ok {
+				return nil, fmt.Errorf("bybit: SpecificParam[%q] must be bool, got %T", key, value)
+			}
+			if !testnet {
+				continue
+			}
+			if _, ok := param["baseURL"]; ok {
+				return nil, fmt.Errorf("bybit: SpecificParam \"baseURL\" and \"testnet\" must not be set together")
+			}
+			opts = append(opts, WithEnvironment(Testnet))
+		}
+	}
+	return opts, nil
+}
+
+// toInt64 accept any integer, integral float, json.Number and numeric string.
+// 設定ファイル由来の値はfloat64やstringになっていることがあるため
+func toInt64(key string, value interface{}) (int64, error) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), nil
+	case int8:
+		return int64(v), nil
+	case int16:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case uint:
+		return int64(v), nil
+	case uint8:
+		return int64(v), nil
+	case uint16:
+		return int64(v), nil
+	case uint32:
+		return int64(v), nil
+	case uint64:
+		if v > math.MaxInt64 {
+			return 0, fmt.Errorf("bybit: SpecificParam[%q] overflows int64: %d", key, v)
+		}
+		return int64(v), nil
+	case float32:
+		return floatToInt64(key, float64(v))
+	case float64:
+		return floatToInt64(key, v)
+	case json.Number:
+		return toInt64(key, string(v))
+	case string:
+		if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return i, nil
+		}
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return 0, fmt.Errorf("bybit: SpecificParam[%q] must be numeric, got %q", key, v)
+		}
+		return floatToInt64(key, f)
+	}
+	return 0, fmt.Errorf("bybit: SpecificParam[%q] must be numeric, got %T", key, value)
+}
+
+func floatToInt64(key string, f float64) (int64, error) {
+	if f != math.Trunc(f) || f > math.MaxInt64 || f < math.MinInt64 {
+		return 0, fmt.Errorf("bybit: SpecificParam[%q] must be integer, got %v", key, f)
+	}
+	return int64(f), nil
+}
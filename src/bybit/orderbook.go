@@ -0,0 +1,237 @@
+package bybit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/TTRSQ/bbwrapper/domains/base"
+	"github.com/TTRSQ/bbwrapper/domains/board"
+)
+
+// BookEvent notification of order book change.
+type BookEvent struct {
+	Topic string
+	// Board 変更後の板
+	board.Board
+}
+
+func (e BookEvent) EventTopic() string {
+	return e.Topic
+}
+
+// WithOrderBookDepth select depth of order book topic, 25 or 200. default: 25
+func WithOrderBookDepth(depth int) StreamOption {
+	return func(c *streamConfig) error {
+		if depth != 25 && depth != 200 {
+			return fmt.Errorf("bybit: order book depth must be 25 or 200, got %d", depth)
+		}
+		c.bookDepth = depth
+		return nil
+	}
+}
+
+func orderBookTopic(depth int, symbol string) string {
+	if depth == 200 {
+		return "orderBook_200.100ms." + symbol
+	}
+	return "orderBookL2_25." + symbol
+}
+
+// OrderBook L2 order book maintained from websocket snapshot and delta.
+// シーケンスの飛びや板の交差を検知すると購読し直してsnapshotから作り直す
+type OrderBook struct {
+	*Subscription
+	symbol string
+
+	mu     sync.RWMutex
+	ready  bool
+	seq    int64
+	levels map[int64]bookLevel
+}
+
+type bookLevel struct {
+	isBuy bool
+	base.Norm
+}
+
+// wsBookItem item of order book topic.
+type wsBookItem struct {
+	Price  number `json:"price"`
+	Symbol string `json:"symbol"`
+	ID     number `json:"id"`
+	Side   string `json:"side"`
+	Size   number `json:"size"`
+}
+
+type wsBookDelta struct {
+	Delete []wsBookItem `json:"delete"`
+	Update []wsBookItem `json:"update"`
+	Insert []wsBookItem `json:"insert"`
+}
+
+// SubscribeOrderBook subscribe order book of symbol. 変更毎にBookEventが届く
+// Eventsを読まずにBoardだけを使っても板が止まらないよう、backpressureの既定はBackpressureDropOldest
+func SubscribeOrderBook(ctx context.Context, symbol string, opts ...StreamOption) (*OrderBook, error) {
+	opts = append([]StreamOption{WithBackpressure(BackpressureDropOldest)}, opts...)
+	config, err := newStreamConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &OrderBook{symbol: symbol, levels: map[int64]bookLevel{}}
+	sub, err := newSubscription(opts, []string{orderBookTopic(config.bookDepth, symbol)}, b.handle)
+	if err != nil {
+		return nil, err
+	}
+	b.Subscription = sub
+	// 切断中の差分は受け取れないので再接続後のsnapshotまで板を無効にする
+	sub.conn.onDisconnect = b.reset
+
+	if err := sub.start(ctx); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Board return current order book. snapshotを受信するまではokがfalse
+func (b *OrderBook) Board() (board.Board, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if !b.ready {
+		return board.Board{}, false
+	}
+	return b.board(), true
+}
+
+func (b *OrderBook) reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.ready = false
+	b.seq = 0
+	b.levels = map[int64]bookLevel{}
+}
+
+func (b *OrderBook) handle(frame wsFrame) ([]Event, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	seq := int64(frame.CrossSeq)
+	switch frame.Type {
+	case "snapshot":
+		items, err := decodeBookSnapshot(frame.Data)
+		if err != nil {
+			return nil, err
+		}
+		b.levels = map[int64]bookLevel{}
+		for _, item := range items {
+			b.levels[int64(item.ID)] = newBookLevel(item)
+		}
+		b.seq = seq
+		b.ready = true
+	case "delta":
+		if !b.ready {
+			// snapshot待ち
+			return nil, nil
+		}
+		if seq != 0 && seq <= b.seq {
+			return nil, b.resync(fmt.Sprintf("cross_seq went back from %d to %d", b.seq, seq))
+		}
+		delta := wsBookDelta{}
+		if err := json.Unmarshal(frame.Data, &delta); err != nil {
+			return nil, fmt.Errorf("bybit: decode order book delta: %w", err)
+		}
+		for _, item := range delta.Delete {
+			if _, ok := b.levels[int64(item.ID)]; !ok {
+				return nil, b.resync(fmt.Sprintf("delete unknown level %d", int64(item.ID)))
+			}
+			delete(b.levels, int64(item.ID))
+		}
+		for _, item := range delta.Update {
+			level, ok := b.levels[int64(item.ID)]
+			if !ok {
+				return nil, b.resync(fmt.Sprintf("update unknown level %d", int64(item.ID)))
+			}
+			level.Size = float64(item.Size)
+			b.levels[int64(item.ID)] = level
+		}
+		for _, item := range delta.Insert {
+			b.levels[int64(item.ID)] = newBookLevel(item)
+		}
+		b.seq = seq
+	default:
+		return nil, nil
+	}
+
+	current := b.board()
+	if len(current.Bids) > 0 && len(current.Asks) > 0 && current.Bids[0].Price >= current.Asks[0].Price {
+		return nil, b.resync(fmt.Sprintf("crossed book bid %v >= ask %v", current.Bids[0].Price, current.Asks[0].Price))
+	}
+	return []Event{BookEvent{Topic: frame.Topic, Board: current}}, nil
+}
+
+// resync discard book and request new snapshot. lockを取った状態で呼ぶ
+func (b *OrderBook) resync(reason string) error {
+	b.ready = false
+	b.seq = 0
+	b.levels = map[int64]bookLevel{}
+	return &wsResyncError{reason: b.symbol + ": " + reason}
+}
+
+// board build sorted board. lockを取った状態で呼ぶ
+func (b *OrderBook) board() board.Board {
+	asks := []base.Norm{}
+	bids := []base.Norm{}
+	for _, level := range b.levels {
+		if level.isBuy {
+			bids = append(bids, level.Norm)
+		} else {
+			asks = append(asks, level.Norm)
+		}
+	}
+	sort.Slice(asks, func(i, j int) bool {
+		return asks[i].Price < asks[j].Price
+	})
+	sort.Slice(bids, func(i, j int) bool {
+		return bids[i].Price > bids[j].Price
+	})
+
+	midPrice := 0.0
+	if len(asks) > 0 && len(bids) > 0 {
+		midPrice = (bids[0].Price + asks[0].Price) / 2
+	}
+	return board.Board{
+		ExchangeName: "bybit",
+		Symbol:       b.symbol,
+		MidPrice:     midPrice,
+		Asks:         asks,
+		Bids:         bids,
+	}
+}
+
+func newBookLevel(item wsBookItem) bookLevel {
+	return bookLevel{
+		isBuy: item.Side == "Buy",
+		Norm: base.Norm{
+			Price: float64(item.Price),
+			Size:  float64(item.Size),
+		},
+	}
+}
+
+// decodeBookSnapshot snapshotはinverseでは配列、一部の契約では{"order_book": [...]}で届く
+func decodeBookSnapshot(data json.RawMessage) ([]wsBookItem, error) {
+	items := []wsBookItem{}
+	if err := json.Unmarshal(data, &items); err == nil {
+		return items, nil
+	}
+	wrapped := struct {
+		OrderBook []wsBookItem `json:"order_book"`
+	}{}
+	if err := json.Unmarshal(data, &wrapped); err != nil {
+		return nil, fmt.Errorf("bybit: decode order book snapshot: %w", err)
+	}
+	return wrapped.OrderBook, nil
+}
@@ -0,0 +1,271 @@
+package bybit
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/TTRSQ/bbwrapper/domains/base"
+	"github.com/TTRSQ/bbwrapper/domains/execution"
+	"github.com/TTRSQ/bbwrapper/domains/order"
+	"github.com/TTRSQ/bbwrapper/domains/order/id"
+	"github.com/TTRSQ/bbwrapper/domains/position"
+	"github.com/TTRSQ/bbwrapper/domains/stock"
+	"github.com/TTRSQ/bbwrapper/interface/exchange"
+)
+
+// private topics.
+const (
+	TopicOrder     = "order"
+	TopicExecution = "execution"
+	TopicPosition  = "position"
+	TopicWallet    = "wallet"
+)
+
+// OrderEvent update of my order.
+type OrderEvent struct {
+	Topic string
+	order.Order
+	// Status bybitのorder_status (New, PartiallyFilled, Filled, Cancelled...)
+	Status     string
+	FilledSize float64
+}
+
+func (e OrderEvent) EventTopic() string {
+	return e.Topic
+}
+
+// ExecutionEvent execution of my order.
+type ExecutionEvent struct {
+	Topic string
+	execution.Execution
+	// OrderID 約定した注文のID
+	OrderID id.ID
+	IsMaker bool
+	Fee     float64
+}
+
+func (e ExecutionEvent) EventTopic() string {
+	return e.Topic
+}
+
+// PositionEvent update of my position.
+type PositionEvent struct {
+	Topic    string
+	Stock    stock.Stock
+	Position position.Position
+}
+
+func (e PositionEvent) EventTopic() string {
+	return e.Topic
+}
+
+// WalletEvent update of my wallet.
+type WalletEvent struct {
+	Topic string
+	base.Balance
+	WalletBalance float64
+}
+
+func (e WalletEvent) EventTopic() string {
+	return e.Topic
+}
+
+// SubscribePrivate subscribe private topics (TopicOrder, TopicExecution, TopicPosition, TopicWallet).
+// 接続、再接続の度にkeyで認証する. 認証のexpiresはWithStreamClockの時計で決まる
+func SubscribePrivate(ctx context.Context, key exchange.Key, topics []string, opts ...StreamOption) (*Subscription, error) {
+	if key.APIKey == "" || key.APISecKey == "" {
+		return nil, errors.New("APIKey and APISecKey Required")
+	}
+	if len(topics) == 0 {
+		return nil, errors.New("bybit: no private topic")
+	}
+	for _, topic := range topics {
+		switch topic {
+		case TopicOrder, TopicExecution, TopicPosition, TopicWallet:
+		default:
+			return nil, fmt.Errorf("bybit: unknown private topic %q", topic)
+		}
+	}
+
+	s, err := newSubscription(opts, topics, decodePrivate)
+	if err != nil {
+		return nil, err
+	}
+	s.conn.auth = func() wsRequest {
+		return wsAuthRequest(key, s.conn.config.now().Add(10*time.Second))
+	}
+	if err := s.start(ctx); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// wsAuthRequest signature = hex(HMAC_SHA256(secret, "GET/realtime" + expires))
+func wsAuthRequest(key exchange.Key, expiresAt time.Time) wsRequest {
+	expires := expiresAt.UnixNano() / int64(time.Millisecond)
+	h := hmac.New(sha256.New, []byte(key.APISecKey))
+	fmt.Fprintf(h, "GET/realtime%d", expires)
+	return wsRequest{
+		Op:   "auth",
+		Args: []interface{}{key.APIKey, expires, fmt.Sprintf("%x", h.Sum(nil))},
+	}
+}
+
+type wsOrder struct {
+	OrderID     string `json:"order_id"`
+	OrderLinkID string `json:"order_link_id"`
+	Symbol      string `json:"symbol"`
+	Side        string `json:"side"`
+	OrderType   string `json:"order_type"`
+	Price       number `json:"price"`
+	Qty         number `json:"qty"`
+	TimeInForce string `json:"time_in_force"`
+	OrderStatus string `json:"order_status"`
+	LeavesQty   number `json:"leaves_qty"`
+	CumExecQty  number `json:"cum_exec_qty"`
+	Timestamp   string `json:"timestamp"`
+}
+
+type wsExecution struct {
+	Symbol      string `json:"symbol"`
+	Side        string `json:"side"`
+	OrderID     string `json:"order_id"`
+	ExecID      string `json:"exec_id"`
+	OrderLinkID string `json:"order_link_id"`
+	Price       number `json:"price"`
+	ExecQty     number `json:"exec_qty"`
+	ExecFee     number `json:"exec_fee"`
+	IsMaker     bool   `json:"is_maker"`
+	TradeTime   string `json:"trade_time"`
+}
+
+type wsPosition struct {
+	Symbol       string `json:"symbol"`
+	Side         string `json:"side"`
+	Size         number `json:"size"`
+	EntryPrice   number `json:"entry_price"`
+	TakeProfit   number `json:"take_profit"`
+	StopLoss     number `json:"stop_loss"`
+	TrailingStop number `json:"trailing_stop"`
+}
+
+type wsWallet struct {
+	Coin             string `json:"coin"`
+	WalletBalance    number `json:"wallet_balance"`
+	AvailableBalance number `json:"available_balance"`
+}
+
+func decodePrivate(frame wsFrame) ([]Event, error) {
+	switch frame.Topic {
+	case TopicOrder:
+		items := []wsOrder{}
+		if err := json.Unmarshal(frame.Data, &items); err != nil {
+			return nil, fmt.Errorf("bybit: decode order: %w", err)
+		}
+		events := make([]Event, len(items))
+		for i, v := range items {
+			updatedAt, _ := time.Parse(time.RFC3339Nano, v.Timestamp)
+			events[i] = OrderEvent{
+				Topic: frame.Topic,
+				Order: order.Order{
+					ID: id.NewID("bybit", v.Symbol, v.OrderID).WithClientID(v.OrderLinkID),
+					Request: order.Request{
+						Norm: base.Norm{
+							Price: float64(v.Price),
+							Size:  float64(v.Qty),
+						},
+						Symbol:    v.Symbol,
+						IsBuy:     v.Side == "Buy",
+						OrderType: v.OrderType,
+					},
+					UpdatedAtUnix: int(updatedAt.Unix()),
+				},
+				Status:     v.OrderStatus,
+				FilledSize: float64(v.CumExecQty),
+			}
+		}
+		return events, nil
+
+	case TopicExecution:
+		items := []wsExecution{}
+		if err := json.Unmarshal(frame.Data, &items); err != nil {
+			return nil, fmt.Errorf("bybit: decode execution: %w", err)
+		}
+		events := make([]Event, len(items))
+		for i, v := range items {
+			occuredAt, _ := time.Parse(time.RFC3339Nano, v.TradeTime)
+			events[i] = ExecutionEvent{
+				Topic: frame.Topic,
+				Execution: execution.Execution{
+					ID: id.NewID("bybit", v.Symbol, v.ExecID),
+					Norm: base.Norm{
+						Price: float64(v.Price),
+						Size:  float64(v.ExecQty),
+					},
+					IsBuy:     v.Side == "Buy",
+					OccuredAt: occuredAt,
+				},
+				OrderID: id.NewID("bybit", v.Symbol, v.OrderID).WithClientID(v.OrderLinkID),
+				IsMaker: v.IsMaker,
+				Fee:     float64(v.ExecFee),
+			}
+		}
+		return events, nil
+
+	case TopicPosition:
+		items := []wsPosition{}
+		if err := json.Unmarshal(frame.Data, &items); err != nil {
+			return nil, fmt.Errorf("bybit: decode position: %w", err)
+		}
+		events := make([]Event, len(items))
+		for i, v := range items {
+			size := math.Abs(float64(v.Size))
+			st := stock.Stock{
+				Symbol:       v.Symbol,
+				TakeProfit:   float64(v.TakeProfit),
+				StopLoss:     float64(v.StopLoss),
+				TrailingStop: float64(v.TrailingStop),
+			}
+			pos := position.Position{Symbol: v.Symbol}
+			norm := base.Norm{Price: float64(v.EntryPrice), Size: size}
+			switch {
+			case size == 0:
+			case v.Side == "Sell":
+				st.Summary = -size
+				st.ShortSize = size
+				pos.Short = []base.Norm{norm}
+			default:
+				st.Summary = size
+				st.LongSize = size
+				pos.Long = []base.Norm{norm}
+			}
+			events[i] = PositionEvent{Topic: frame.Topic, Stock: st, Position: pos}
+		}
+		return events, nil
+
+	case TopicWallet:
+		items := []wsWallet{}
+		if err := json.Unmarshal(frame.Data, &items); err != nil {
+			return nil, fmt.Errorf("bybit: decode wallet: %w", err)
+		}
+		events := make([]Event, len(items))
+		for i, v := range items {
+			events[i] = WalletEvent{
+				Topic: frame.Topic,
+				Balance: base.Balance{
+					CurrencyCode: v.Coin,
+					Size:         float64(v.AvailableBalance),
+				},
+				WalletBalance: float64(v.WalletBalance),
+			}
+		}
+		return events, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,147 @@
+package bybit
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/TTRSQ/bbwrapper/interface/exchange"
+)
+
+// RateLimitPolicy behavior when the quota of endpoint group is used up.
+type RateLimitPolicy int
+
+const (
+	// RateLimitTrackOnly 残量の記録のみ行いリクエストは常に送る
+	RateLimitTrackOnly RateLimitPolicy = iota
+	// RateLimitBlock 残量が0の場合はリセットまで待ってから送る
+	RateLimitBlock
+	// RateLimitFailFast 残量が0の場合は送らずにErrRateLimitedを返す
+	RateLimitFailFast
+)
+
+// rateLimitBody rate limit fields of private api response.
+type rateLimitBody struct {
+	RateLimitStatus  *int   `json:"rate_limit_status"`
+	RateLimitResetMs number `json:"rate_limit_reset_ms"`
+	RateLimit        int    `json:"rate_limit"`
+}
+
+// rateLimitCoolDown 403, 10006でリセット時刻が分からない場合に待つ時間. bybitの制限は1分単位
+const rateLimitCoolDown = time.Minute
+
+// rateLimiter track remaining quota per endpoint group.
+type rateLimiter struct {
+	mu       sync.Mutex
+	policy   RateLimitPolicy
+	limits   map[string]exchange.RateLimit
+	now      func() time.Time
+	coolDown time.Duration
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{
+		limits:   map[string]exchange.RateLimit{},
+		now:      time.Now,
+		coolDown: rateLimitCoolDown,
+	}
+}
+
+// rateLimitGroup bybitのv2 apiはエンドポイント毎に制限がかかるためpathをそのままグループとする
+func rateLimitGroup(path string) string {
+	return path
+}
+
+// status return copy of current quota.
+func (r *rateLimiter) status() map[string]exchange.RateLimit {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ret := make(map[string]exchange.RateLimit, len(r.limits))
+	for k, v := range r.limits {
+		ret[k] = v
+	}
+	return ret
+}
+
+// wait apply policy before sending request of group, then count the request.
+func (r *rateLimiter) wait(ctx context.Context, group string) error {
+	for {
+		r.mu.Lock()
+		limit, ok := r.limits[group]
+		now := r.now()
+		inWindow := ok && now.Before(limit.ResetAt)
+		if !inWindow || limit.Remaining > 0 || r.policy == RateLimitTrackOnly {
+			// 応答で上書きされるまでは手元で数える
+			if inWindow && limit.Remaining > 0 {
+				limit.Remaining--
+				r.limits[group] = limit
+			}
+			r.mu.Unlock()
+			return nil
+		}
+		r.mu.Unlock()
+
+		if r.policy == RateLimitFailFast {
+			return fmt.Errorf("bybit: %s: quota used up until %s: %w", group, limit.ResetAt.Format(time.RFC3339Nano), ErrRateLimited)
+		}
+
+		timer := time.NewTimer(limit.ResetAt.Sub(now))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("bybit: %s: waiting for rate limit reset: %w", group, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// update record quota from response. bodyの値を優先し、なければheaderを見る
+func (r *rateLimiter) update(group string, header http.Header, body rateLimitBody) {
+	limit := exchange.RateLimit{Group: group}
+	switch {
+	case body.RateLimitStatus != nil:
+		limit.Remaining = *body.RateLimitStatus
+		limit.Limit = body.RateLimit
+		limit.ResetAt = msToTime(int64(body.RateLimitResetMs))
+	case header.Get("X-Bapi-Limit-Status") != "":
+		limit.Remaining, _ = strconv.Atoi(header.Get("X-Bapi-Limit-Status"))
+		limit.Limit, _ = strconv.Atoi(header.Get("X-Bapi-Limit"))
+		resetMs, _ := strconv.ParseInt(header.Get("X-Bapi-Limit-Reset-Timestamp"), 10, 64)
+		limit.ResetAt = msToTime(resetMs)
+	default:
+		return
+	}
+
+	r.mu.Lock()
+	r.limits[group] = limit
+	r.mu.Unlock()
+}
+
+// exhaust mark group as used up (e.g. after 10006 too many visits).
+// resetAtが分からなければcoolDownの間使い切ったものとする
+func (r *rateLimiter) exhaust(group string, resetAt time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	limit := r.limits[group]
+	limit.Group = group
+	limit.Remaining = 0
+	if now := r.now(); resetAt.IsZero() && !limit.ResetAt.After(now) {
+		resetAt = now.Add(r.coolDown)
+	}
+	if resetAt.After(limit.ResetAt) {
+		limit.ResetAt = resetAt
+	}
+	r.limits[group] = limit
+}
+
+func msToTime(ms int64) time.Time {
+	if ms == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ms*int64(time.Millisecond))
+}
@@ -0,0 +1,175 @@
+package bybit
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Rotation period of record file.
+type Rotation int
+
+const (
+	// RotateHourly 1時間毎にファイルを分ける
+	RotateHourly Rotation = iota
+	// RotateDaily 1日毎にファイルを分ける
+	RotateDaily
+)
+
+const recordExt = ".jsonl.gz"
+
+// recordLine one line of record file.
+type recordLine struct {
+	At    time.Time       `json:"at"`
+	Frame json.RawMessage `json:"frame"`
+}
+
+// Recorder persist raw websocket frames to gzip compressed json lines.
+// ファイル名は期間の開始時刻(UTC)で、名前順に並べると時系列になる
+type Recorder struct {
+	dir      string
+	rotation Rotation
+
+	mu     sync.Mutex
+	period string
+	file   *os.File
+	gz     *gzip.Writer
+	err    error
+}
+
+// NewRecorder return Recorder writing files under dir.
+func NewRecorder(dir string, rotation Rotation) (*Recorder, error) {
+	if rotation != RotateHourly && rotation != RotateDaily {
+		return nil, fmt.Errorf("bybit: unknown rotation %d", rotation)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("bybit: recorder: %w", err)
+	}
+	return &Recorder{dir: dir, rotation: rotation}, nil
+}
+
+// WithRecorder record every raw frame received by stream.
+func WithRecorder(r *Recorder) StreamOption {
+	return func(c *streamConfig) error {
+		if r == nil {
+			return fmt.Errorf("bybit: recorder must not be nil")
+		}
+		c.recorder = r
+		return nil
+	}
+}
+
+func (r *Recorder) periodOf(at time.Time) string {
+	if r.rotation == RotateDaily {
+		return at.UTC().Format("20060102")
+	}
+	return at.UTC().Format("2006010215")
+}
+
+// Record write frame received at given time.
+func (r *Recorder) Record(at time.Time, frame []byte) error {
+	line, err := json.Marshal(recordLine{At: at, Frame: frame})
+	if err != nil {
+		return r.setErr(fmt.Errorf("bybit: recorder: %w", err))
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if period := r.periodOf(at); period != r.period || r.gz == nil {
+		if err := r.rotate(period); err != nil {
+			return r.setErrLocked(err)
+		}
+	}
+	if _, err := r.gz.Write(append(line, '\n')); err != nil {
+		return r.setErrLocked(fmt.Errorf("bybit: recorder: %w", err))
+	}
+	return nil
+}
+
+// rotate close current file and open file of period. lockを取った状態で呼ぶ
+func (r *Recorder) rotate(period string) error {
+	if err := r.closeFile(); err != nil {
+		return err
+	}
+	// 再起動で同じ期間のファイルがあれば追記する (gzipのmulti memberとして読める)
+	file, err := os.OpenFile(filepath.Join(r.dir, period+recordExt), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("bybit: recorder: %w", err)
+	}
+	r.period = period
+	r.file = file
+	r.gz = gzip.NewWriter(file)
+	return nil
+}
+
+// closeFile lockを取った状態で呼ぶ
+func (r *Recorder) closeFile() error {
+	if r.gz == nil {
+		return nil
+	}
+	err := r.gz.Close()
+	if cerr := r.file.Close(); err == nil {
+		err = cerr
+	}
+	r.gz = nil
+	r.file = nil
+	if err != nil {
+		return fmt.Errorf("bybit: recorder: %w", err)
+	}
+	return nil
+}
+
+// Flush write buffered frames to current file.
+func (r *Recorder) Flush() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.gz == nil {
+		return nil
+	}
+	if err := r.gz.Flush(); err != nil {
+		return r.setErrLocked(fmt.Errorf("bybit: recorder: %w", err))
+	}
+	return nil
+}
+
+// Err return first error of recording. streamは記録に失敗しても止まらないのでここで確認する
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+func (r *Recorder) setErr(err error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.setErrLocked(err)
+}
+
+func (r *Recorder) setErrLocked(err error) error {
+	if r.err == nil {
+		r.err = err
+	}
+	return err
+}
+
+// Close flush and close current file.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.closeFile()
+}
+
+// RecordFiles return record files under dir in chronological order.
+func RecordFiles(dir string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*"+recordExt))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
@@ -0,0 +1,231 @@
+package bybit
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TTRSQ/bbwrapper/domains/execution"
+	"github.com/TTRSQ/bbwrapper/interface/exchange"
+)
+
+// replayStream Stream of trades read from record files.
+type replayStream struct {
+	files []string
+	speed float64
+	buf   chan execution.Execution
+
+	events  chan exchange.StreamEvent
+	closeCh chan struct{}
+	done    chan struct{}
+
+	mu      sync.Mutex
+	started bool
+	closed  bool
+	err     error
+}
+
+// NewReplayStream return Stream replaying trades of record files in given order.
+// speedは1で記録時と同じ速さ、2なら2倍速、0なら待たずに流す
+func NewReplayStream(speed float64, files ...string) (exchange.LifecycleStream, error) {
+	if speed < 0 {
+		return nil, fmt.Errorf("bybit: replay speed must not be negative: %v", speed)
+	}
+	if len(files) == 0 {
+		return nil, errors.New("bybit: no record file to replay")
+	}
+	return &replayStream{
+		files:   files,
+		speed:   speed,
+		buf:     make(chan execution.Execution, 1024),
+		events:  make(chan exchange.StreamEvent, 16),
+		closeCh: make(chan struct{}),
+		done:    make(chan struct{}),
+	}, nil
+}
+
+func (s *replayStream) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		return errors.New("bybit: stream already started")
+	}
+	if s.closed {
+		return errStreamClosed
+	}
+	s.started = true
+	s.emit(exchange.StreamConnected, nil)
+	go s.run()
+	return nil
+}
+
+// Read return replayed execution. 再生し終えて全て読むとio.EOFを返す
+func (s *replayStream) Read() (execution.Execution, error) {
+	select {
+	case e := <-s.buf:
+		return e, nil
+	default:
+	}
+
+	select {
+	case <-s.done:
+		// doneの後にbufへ書かれることはないので残りを読み切る
+		select {
+		case e := <-s.buf:
+			return e, nil
+		default:
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return execution.Execution{}, s.err
+	default:
+		return execution.Execution{}, nil
+	}
+}
+
+func (s *replayStream) Events() <-chan exchange.StreamEvent {
+	return s.events
+}
+
+func (s *replayStream) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.closeCh)
+	started := s.started
+	s.mu.Unlock()
+
+	if started {
+		<-s.done
+	} else {
+		close(s.events)
+	}
+	return nil
+}
+
+func (s *replayStream) run() {
+	defer close(s.done)
+	defer close(s.events)
+
+	var first, wallStart time.Time
+	err := func() error {
+		for _, file := range s.files {
+			err := readRecords(file, func(line recordLine) error {
+				if first.IsZero() {
+					first = line.At
+					wallStart = time.Now()
+				}
+				if err := s.wait(wallStart, line.At.Sub(first)); err != nil {
+					return err
+				}
+				return s.handle(line.Frame)
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return io.EOF
+	}()
+
+	s.mu.Lock()
+	if !errors.Is(err, errStreamClosed) {
+		s.err = err
+	}
+	s.mu.Unlock()
+	s.emit(exchange.StreamDisconnected, err)
+}
+
+// wait sleep until elapsed/speed from wallStart.
+func (s *replayStream) wait(wallStart time.Time, elapsed time.Duration) error {
+	if s.speed == 0 {
+		select {
+		case <-s.closeCh:
+			return errStreamClosed
+		default:
+			return nil
+		}
+	}
+	d := time.Until(wallStart.Add(time.Duration(float64(elapsed) / s.speed)))
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-s.closeCh:
+		return errStreamClosed
+	case <-timer.C:
+		return nil
+	}
+}
+
+// handle decode trades of frame. 再生では取りこぼさないよう読まれるまで待つ
+func (s *replayStream) handle(raw json.RawMessage) error {
+	frame := wsFrame{}
+	if err := json.Unmarshal(raw, &frame); err != nil {
+		return fmt.Errorf("bybit: replay decode: %w", err)
+	}
+	if !strings.HasPrefix(frame.Topic, "trade.") {
+		return nil
+	}
+	executions, err := decodeTrades(frame.Data)
+	if err != nil {
+		return err
+	}
+	for _, e := range executions {
+		select {
+		case s.buf <- e:
+		case <-s.closeCh:
+			return errStreamClosed
+		}
+	}
+	return nil
+}
+
+func (s *replayStream) emit(t exchange.StreamEventType, err error) {
+	select {
+	case s.events <- exchange.StreamEvent{Type: t, At: time.Now(), Err: err}:
+	default:
+	}
+}
+
+// readRecords call fn for each line of record file.
+func readRecords(file string, fn func(line recordLine) error) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("bybit: replay: %w", err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("bybit: replay %s: %w", file, err)
+	}
+	defer gz.Close()
+
+	scanner := bufio.NewScanner(gz)
+	// 板のsnapshotなど大きなframeがある
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := recordLine{}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return fmt.Errorf("bybit: replay %s: %w", file, err)
+		}
+		if err := fn(line); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("bybit: replay %s: %w", file, err)
+	}
+	return nil
+}
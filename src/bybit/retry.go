@@ -0,0 +1,166 @@
+package bybit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// RetryPolicy retry setting of api requests.
+// GETと取消、変更は常にリトライ対象、注文作成はorder_link_idがある場合のみリトライする
+type RetryPolicy struct {
+	// MaxAttempts 初回を含めた最大試行回数。1以下ならリトライしない
+	MaxAttempts int
+	// BaseDelay 1回目のリトライまでの待ち時間。以降倍々になる
+	BaseDelay time.Duration
+	// MaxDelay 待ち時間の上限
+	MaxDelay time.Duration
+	// Jitter 待ち時間をランダムに増減させる割合 (0 ~ 1)
+	Jitter float64
+	// RetryOn リトライするret_code。5xxと通信エラーはこれに関係なくリトライする
+	RetryOn []int
+}
+
+// DefaultRetryPolicy return recommended retry policy.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   200 * time.Millisecond,
+		MaxDelay:    5 * time.Second,
+		Jitter:      0.2,
+		RetryOn: []int{
+			10002, // request expired. 新しいtimestampで署名し直せば通る
+			10006, // too many visits
+			10016, // service error
+		},
+	}
+}
+
+// 重複して送ると二重発注になるエンドポイント
+var orderCreatePaths = map[string]bool{
+	"/v2/private/order/create":      true,
+	"/v2/private/stop-order/create": true,
+}
+
+// 何度送っても結果が変わらないPOST. ここにないPOSTはリトライしない
+var idempotentPostPaths = map[string]bool{
+	"/v2/private/order/replace":         true,
+	"/v2/private/order/cancel":          true,
+	"/v2/private/order/cancelAll":       true,
+	"/v2/private/stop-order/replace":    true,
+	"/v2/private/stop-order/cancel":     true,
+	"/v2/private/stop-order/cancelAll":  true,
+	"/v2/private/position/trading-stop": true,
+}
+
+// idempotent return whether request can be sent again safely.
+func idempotent(method, path string, param map[string]string) bool {
+	if method == http.MethodGet {
+		return true
+	}
+	if orderCreatePaths[path] {
+		// order_link_idがあれば取引所側で重複が弾かれる
+		return param["order_link_id"] != ""
+	}
+	return idempotentPostPaths[path]
+}
+
+// createdByEarlierAttempt returned by send when retried order create is rejected as duplicate order_link_id.
+// 前の試行が取引所に届いていたので、呼び出し側で注文を照会して成功として扱う
+type createdByEarlierAttempt struct {
+	err error
+}
+
+func (e *createdByEarlierAttempt) Error() string {
+	return e.err.Error()
+}
+
+func (e *createdByEarlierAttempt) Unwrap() error {
+	return e.err
+}
+
+func (p RetryPolicy) shouldRetry(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		if apiErr.HTTPStatus/100 == 5 {
+			return true
+		}
+		for _, code := range p.RetryOn {
+			if apiErr.RetCode == code {
+				return true
+			}
+		}
+		return false
+	}
+
+	// タイムアウト、接続断などの通信エラー
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+// backoff return wait duration before the attempt-th retry (1 origin).
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := float64(p.BaseDelay) * math.Pow(2, float64(attempt-1))
+	if p.MaxDelay > 0 && d > float64(p.MaxDelay) {
+		d = float64(p.MaxDelay)
+	}
+	if p.Jitter > 0 {
+		d += d * p.Jitter * (rand.Float64()*2 - 1)
+	}
+	return time.Duration(d)
+}
+
+// send build and send request with retry policy.
+// buildは試行毎に呼ばれ、新しいtimestampで署名されたリクエストを返す
+func (bb *bybit) send(ctx context.Context, method, path string, param map[string]string, build func() (*http.Request, error)) ([]byte, error) {
+	retryable := idempotent(method, path, param)
+
+	for attempt := 1; ; attempt++ {
+		if err := bb.rateLimiter.wait(ctx, rateLimitGroup(path)); err != nil {
+			return nil, err
+		}
+		bb.syncClock(ctx)
+		req, err := build()
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := bb.request(req)
+		if err == nil {
+			return res, nil
+		}
+		if attempt > 1 && orderCreatePaths[path] && errors.Is(err, ErrDuplicateClientID) {
+			return nil, &createdByEarlierAttempt{err}
+		}
+		if errors.Is(err, ErrTimestampOutOfWindow) {
+			bb.clock.invalidate()
+		}
+		if !retryable || attempt >= bb.retryPolicy.MaxAttempts || !bb.retryPolicy.shouldRetry(err) {
+			return nil, err
+		}
+
+		wait := bb.retryPolicy.backoff(attempt)
+		bb.logger.Log(LogInfo, "bybit request retry", Fields{
+			"endpoint": path,
+			"attempt":  attempt + 1,
+			"wait":     wait,
+			"error":    err.Error(),
+		})
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("bybit: %s: retry aborted: %w", path, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package bybit
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// clockSync measured offset between local clock and bybit server.
+type clockSync struct {
+	mu       sync.Mutex
+	offset   time.Duration
+	syncedAt time.Time
+	// interval 0ならサーバー時刻との同期は行わずローカル時刻をそのまま使う
+	interval time.Duration
+}
+
+func (c *clockSync) get() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.offset
+}
+
+func (c *clockSync) set(offset time.Duration, at time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.offset = offset
+	c.syncedAt = at
+}
+
+// stale return whether offset should be measured again.
+func (c *clockSync) stale(now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.interval > 0 && (c.syncedAt.IsZero() || now.Sub(c.syncedAt) >= c.interval)
+}
+
+// invalidate force resync before next request (e.g. after request expired error).
+func (c *clockSync) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.syncedAt = time.Time{}
+}
+
+// timestamp return current time corrected by server offset.
+func (bb *bybit) timestamp() time.Time {
+	if bb.clock.interval == 0 {
+		return bb.now()
+	}
+	return bb.now().Add(bb.clock.get())
+}
+
+func (bb *bybit) ServerTime() (time.Time, error) {
+	return bb.ServerTimeCtx(context.Background())
+}
+
+// ServerTimeCtx fetch bybit server time and update clock offset.
+func (bb *bybit) ServerTimeCtx(ctx context.Context) (time.Time, error) {
+	const path = "/v2/public/time"
+
+	// 署名も時刻補正も不要なのでsendを通さず直接送る
+	req, err := http.NewRequestWithContext(ctx, "GET", bb.endpoint(path), nil)
+	if err != nil {
+		return time.Time{}, err
+	}
+	sentAt := bb.now()
+	res, err := bb.request(req)
+	if err != nil {
+		return time.Time{}, err
+	}
+	receivedAt := bb.now()
+
+	type Res struct {
+		RetCode int    `json:"ret_code"`
+		RetMsg  string `json:"ret_msg"`
+		TimeNow number `json:"time_now"`
+	}
+	resData := Res{}
+	if err := decode(path, res, &resData); err != nil {
+		return time.Time{}, err
+	}
+
+	serverTime := time.Unix(0, int64(float64(resData.TimeNow)*float64(time.Second)))
+	// 往復の中間時点でサーバー時刻が打たれたとみなす
+	midpoint := sentAt.Add(receivedAt.Sub(sentAt) / 2)
+	bb.clock.set(serverTime.Sub(midpoint), receivedAt)
+
+	return serverTime, nil
+}
+
+// syncClock resync server time if needed. 失敗しても前回のoffsetのまま続行する
+func (bb *bybit) syncClock(ctx context.Context) {
+	if !bb.clock.stale(bb.now()) {
+		return
+	}
+	if _, err := bb.ServerTimeCtx(ctx); err != nil {
+		bb.logger.Log(LogWarn, "bybit server time sync failed", Fields{"error": err.Error()})
+	}
+}
@@ -0,0 +1,134 @@
+package bybit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/TTRSQ/bbwrapper/domains/base"
+	"github.com/TTRSQ/bbwrapper/domains/execution"
+	"github.com/TTRSQ/bbwrapper/domains/order/id"
+	"github.com/TTRSQ/bbwrapper/interface/exchange"
+)
+
+// ErrStreamOverflow returned by Read when buffer of stream overflowed and executions were dropped.
+var ErrStreamOverflow = errors.New("bybit: stream buffer overflow")
+
+type tradeStream struct {
+	symbol string
+	conn   *wsConn
+	buf    chan execution.Execution
+
+	mu       sync.Mutex
+	started  bool
+	overflow bool
+}
+
+// NewTradeStream return Stream of public trades of symbol (e.g. "BTCUSD").
+func NewTradeStream(symbol string, opts ...StreamOption) (exchange.LifecycleStream, error) {
+	config, err := newStreamConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	s := &tradeStream{
+		symbol: symbol,
+		buf:    make(chan execution.Execution, config.bufferSize),
+	}
+	s.conn = newWSConn(config, []string{"trade." + symbol}, s.handle)
+	return s, nil
+}
+
+func (s *tradeStream) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		return errors.New("bybit: stream already started")
+	}
+	if err := s.conn.start(); err != nil {
+		return err
+	}
+	s.started = true
+	return nil
+}
+
+// Read return buffered execution. まだ届いていなければ空のExecutionとnilを返す
+func (s *tradeStream) Read() (execution.Execution, error) {
+	select {
+	case e := <-s.buf:
+		return e, nil
+	default:
+	}
+
+	s.mu.Lock()
+	overflow := s.overflow
+	s.overflow = false
+	s.mu.Unlock()
+	if overflow {
+		return execution.Execution{}, ErrStreamOverflow
+	}
+	return execution.Execution{}, s.conn.lastErr()
+}
+
+func (s *tradeStream) Events() <-chan exchange.StreamEvent {
+	return s.conn.events
+}
+
+func (s *tradeStream) Close() error {
+	return s.conn.close()
+}
+
+func (s *tradeStream) handle(frame wsFrame) error {
+	executions, err := decodeTrades(frame.Data)
+	if err != nil {
+		return err
+	}
+	for _, e := range executions {
+		select {
+		case s.buf <- e:
+		default:
+			s.mu.Lock()
+			s.overflow = true
+			s.mu.Unlock()
+		}
+	}
+	return nil
+}
+
+// wsTrade item of trade topic.
+type wsTrade struct {
+	Timestamp   string `json:"timestamp"`
+	TradeTimeMs number `json:"trade_time_ms"`
+	Symbol      string `json:"symbol"`
+	Side        string `json:"side"`
+	Size        number `json:"size"`
+	Price       number `json:"price"`
+	TradeID     string `json:"trade_id"`
+	CrossSeq    number `json:"cross_seq"`
+}
+
+func decodeTrades(data json.RawMessage) ([]execution.Execution, error) {
+	trades := []wsTrade{}
+	if err := json.Unmarshal(data, &trades); err != nil {
+		return nil, fmt.Errorf("bybit: decode trade: %w", err)
+	}
+
+	executions := make([]execution.Execution, 0, len(trades))
+	for _, t := range trades {
+		occuredAt := msToTime(int64(t.TradeTimeMs))
+		if occuredAt.IsZero() {
+			occuredAt, _ = time.Parse(time.RFC3339Nano, t.Timestamp)
+		}
+		executions = append(executions, execution.Execution{
+			ID: id.NewID("bybit", t.Symbol, t.TradeID),
+			Norm: base.Norm{
+				Price: float64(t.Price),
+				Size:  float64(t.Size),
+			},
+			IsBuy:     t.Side == "Buy",
+			OccuredAt: occuredAt,
+		})
+	}
+	return executions, nil
+}
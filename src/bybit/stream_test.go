@@ -0,0 +1,1011 @@
+package bybit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/TTRSQ/bbwrapper/interface/exchange"
+	"github.com/gorilla/websocket"
+)
+
+// newFakeWSServer start in-process websocket server. handleは接続毎に呼ばれる
+func newFakeWSServer(t *testing.T, handle func(conn *websocket.Conn)) (*httptest.Server, string) {
+	t.Helper()
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		handle(conn)
+	}))
+	return server, "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+// expectOp read request from client and check op and args.
+func expectOp(t *testing.T, conn *websocket.Conn, op string, args ...string) {
+	t.Helper()
+	req := wsRequest{}
+	if err := conn.ReadJSON(&req); err != nil {
+		t.Error(err)
+		return
+	}
+	if req.Op != op {
+		t.Errorf("op = %s, want %s", req.Op, op)
+	}
+	for i, arg := range args {
+		if i >= len(req.Args) || req.Args[i] != arg {
+			t.Errorf("args = %v, want %v", req.Args, args)
+			return
+		}
+	}
+}
+
+func TestTradeStream(t *testing.T) {
+	server, url := newFakeWSServer(t, func(conn *websocket.Conn) {
+		expectOp(t, conn, "subscribe", "trade.BTCUSD")
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"success":true,"ret_msg":"","conn_id":"x","request":{"op":"subscribe","args":["trade.BTCUSD"]}}`))
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"topic":"trade.BTCUSD","data":[{"timestamp":"2020-01-12T16:59:59.000Z","trade_time_ms":1578848399000,"symbol":"BTCUSD","side":"Sell","size":328,"price":8098,"tick_direction":"MinusTick","trade_id":"00c706e1-ba52-5bb0-98d0-bf694bdc69f7","cross_seq":1052816407}]}`))
+		// クライアントが閉じるまで待つ
+		conn.ReadMessage()
+	})
+	defer server.Close()
+
+	stream, err := NewTradeStream("BTCUSD", WithStreamURL(url))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		e, err := stream.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.LocalID == "" {
+			time.Sleep(10 * time.Millisecond)
+			continue
+		}
+		if e.LocalID != "00c706e1-ba52-5bb0-98d0-bf694bdc69f7" || e.Symbol != "BTCUSD" {
+			t.Errorf("id = %+v", e.ID)
+		}
+		if e.Price != 8098 || e.Size != 328 || e.IsBuy {
+			t.Errorf("execution = %+v", e)
+		}
+		if !e.OccuredAt.Equal(time.Date(2020, 1, 12, 16, 59, 59, 0, time.UTC)) {
+			t.Errorf("OccuredAt = %s", e.OccuredAt)
+		}
+		return
+	}
+	t.Fatal("execution not received")
+}
+
+func TestTradeStreamReconnect(t *testing.T) {
+	var connections int32
+	server, url := newFakeWSServer(t, func(conn *websocket.Conn) {
+		n := atomic.AddInt32(&connections, 1)
+		expectOp(t, conn, "subscribe", "trade.BTCUSD")
+		if n == 1 {
+			// 1回目はすぐに切断する
+			return
+		}
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"topic":"trade.BTCUSD","data":[{"trade_time_ms":1578848399000,"symbol":"BTCUSD","side":"Buy","size":1,"price":8098,"trade_id":"a"}]}`))
+		conn.ReadMessage()
+	})
+	defer server.Close()
+
+	stream, err := NewTradeStream("BTCUSD", WithStreamURL(url), WithReconnect(10*time.Millisecond, 50*time.Millisecond, 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	got := []exchange.StreamEventType{}
+	timeout := time.After(3 * time.Second)
+	for len(got) < 4 {
+		select {
+		case e := <-stream.Events():
+			got = append(got, e.Type)
+		case <-timeout:
+			t.Fatalf("events = %v", got)
+		}
+	}
+	want := []exchange.StreamEventType{exchange.StreamConnected, exchange.StreamDisconnected, exchange.StreamReconnected, exchange.StreamGap}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("events = %v, want %v", got, want)
+	}
+
+	for {
+		e, err := stream.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.LocalID == "a" {
+			break
+		}
+		select {
+		case <-timeout:
+			t.Fatal("execution not received after reconnect")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestTradeStreamSkipsBrokenFrame(t *testing.T) {
+	server, url := newFakeWSServer(t, func(conn *websocket.Conn) {
+		expectOp(t, conn, "subscribe", "trade.BTCUSD")
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"topic":"trade.BTCUSD","data":[`))
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"topic":"trade.BTCUSD","data":[{"trade_time_ms":1578848399000,"symbol":"BTCUSD","side":"Buy","size":1,"price":8098,"trade_id":"a"}]}`))
+		conn.ReadMessage()
+	})
+	defer server.Close()
+
+	stream, err := NewTradeStream("BTCUSD", WithStreamURL(url))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	timeout := time.After(3 * time.Second)
+	got := []exchange.StreamEventType{}
+	for len(got) < 2 {
+		select {
+		case e := <-stream.Events():
+			got = append(got, e.Type)
+		case <-timeout:
+			t.Fatalf("events = %v", got)
+		}
+	}
+	want := []exchange.StreamEventType{exchange.StreamConnected, exchange.StreamGap}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("events = %v, want %v", got, want)
+	}
+
+	for {
+		e, err := stream.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.LocalID == "a" {
+			return
+		}
+		select {
+		case <-timeout:
+			t.Fatal("execution after broken frame not received")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestStreamEventsNotDropped(t *testing.T) {
+	config, err := newStreamConfig(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := newWSConn(config, nil, nil)
+	go w.forward()
+
+	// 受け手が読まない間に再接続を繰り返す
+	for i := 0; i < 100; i++ {
+		w.emit(exchange.StreamDisconnected, fmt.Errorf("disconnect %d", i))
+		w.emit(exchange.StreamReconnected, nil)
+		w.emit(exchange.StreamGap, nil)
+	}
+	w.emit(exchange.StreamDisconnected, errors.New("last"))
+	close(w.done)
+
+	got := []exchange.StreamEvent{}
+	for e := range w.events {
+		got = append(got, e)
+	}
+	gap := false
+	for _, e := range got {
+		gap = gap || e.Type == exchange.StreamGap
+	}
+	if !gap {
+		t.Errorf("gap must be delivered: %v", got)
+	}
+	if last := got[len(got)-1]; last.Type != exchange.StreamDisconnected || last.Err == nil || last.Err.Error() != "last" {
+		t.Errorf("last event = %+v", last)
+	}
+	if len(got) > 16+maxPendingEvents+1 {
+		t.Errorf("events must be coalesced: %d", len(got))
+	}
+}
+
+func TestTradeStreamCloseWhileStarting(t *testing.T) {
+	server, url := newFakeWSServer(t, func(conn *websocket.Conn) {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+	defer server.Close()
+
+	for i := 0; i < 20; i++ {
+		stream, err := NewTradeStream("BTCUSD", WithStreamURL(url))
+		if err != nil {
+			t.Fatal(err)
+		}
+		started := make(chan error, 1)
+		go func() {
+			started <- stream.Start()
+		}()
+		stream.Close()
+		<-started
+
+		// Startが間に合ったかに関わらずEventsは閉じられる
+		timeout := time.After(3 * time.Second)
+	drain:
+		for {
+			select {
+			case _, ok := <-stream.Events():
+				if !ok {
+					break drain
+				}
+			case <-timeout:
+				t.Fatal("events must be closed")
+			}
+		}
+	}
+}
+
+func TestSubscribeTrades(t *testing.T) {
+	server, url := newFakeWSServer(t, func(conn *websocket.Conn) {
+		expectOp(t, conn, "subscribe", "trade.BTCUSD")
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"topic":"trade.BTCUSD","data":[{"trade_time_ms":1578848399000,"symbol":"BTCUSD","side":"Buy","size":1,"price":8098,"trade_id":"a"},{"trade_time_ms":1578848399001,"symbol":"BTCUSD","side":"Sell","size":2,"price":8097,"trade_id":"b"}]}`))
+		conn.ReadMessage()
+	})
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sub, err := SubscribeTrades(ctx, "BTCUSD", WithStreamURL(url))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := []string{}
+	for e := range sub.Events() {
+		if trade, ok := e.(TradeEvent); ok {
+			ids = append(ids, trade.LocalID)
+		}
+		if len(ids) == 2 {
+			cancel()
+		}
+	}
+	if fmt.Sprint(ids) != "[a b]" {
+		t.Errorf("ids = %v", ids)
+	}
+	if !errors.Is(sub.Err(), context.Canceled) {
+		t.Errorf("err = %v", sub.Err())
+	}
+}
+
+func TestSubscribeBackpressureError(t *testing.T) {
+	server, url := newFakeWSServer(t, func(conn *websocket.Conn) {
+		expectOp(t, conn, "subscribe", "trade.BTCUSD")
+		for i := 0; i < 3; i++ {
+			conn.WriteMessage(websocket.TextMessage, []byte(`{"topic":"trade.BTCUSD","data":[{"trade_time_ms":1578848399000,"symbol":"BTCUSD","side":"Buy","size":1,"price":8098,"trade_id":"a"}]}`))
+		}
+		conn.ReadMessage()
+	})
+	defer server.Close()
+
+	sub, err := SubscribeTrades(context.Background(), "BTCUSD", WithStreamURL(url), WithStreamBufferSize(2), WithBackpressure(BackpressureError))
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-sub.Done():
+	case <-time.After(3 * time.Second):
+		t.Fatal("subscription must stop")
+	}
+	if !errors.Is(sub.Err(), ErrSlowConsumer) {
+		t.Errorf("err = %v", sub.Err())
+	}
+}
+
+func TestOrderBookResync(t *testing.T) {
+	snapshot := `{"topic":"orderBookL2_25.BTCUSD","type":"snapshot","data":[{"price":"2999.00","symbol":"BTCUSD","id":29990000,"side":"Buy","size":9},{"price":"3001.00","symbol":"BTCUSD","id":30010000,"side":"Sell","size":10}],"cross_seq":100}`
+	server, url := newFakeWSServer(t, func(conn *websocket.Conn) {
+		expectOp(t, conn, "subscribe", "orderBookL2_25.BTCUSD")
+		conn.WriteMessage(websocket.TextMessage, []byte(snapshot))
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"topic":"orderBookL2_25.BTCUSD","type":"delta","data":{"delete":[],"update":[{"price":"2999.00","symbol":"BTCUSD","id":29990000,"side":"Buy","size":5}],"insert":[{"price":"3000.00","symbol":"BTCUSD","id":30000000,"side":"Sell","size":1}]},"cross_seq":101}`))
+		// シーケンスが戻ったので購読し直されるはず
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"topic":"orderBookL2_25.BTCUSD","type":"delta","data":{"delete":[],"update":[],"insert":[]},"cross_seq":99}`))
+		expectOp(t, conn, "unsubscribe", "orderBookL2_25.BTCUSD")
+		expectOp(t, conn, "subscribe", "orderBookL2_25.BTCUSD")
+		conn.WriteMessage(websocket.TextMessage, []byte(snapshot))
+		conn.ReadMessage()
+	})
+	defer server.Close()
+
+	book, err := SubscribeOrderBook(context.Background(), "BTCUSD", WithStreamURL(url))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer book.Close()
+
+	boards := []BookEvent{}
+	gap := false
+	timeout := time.After(3 * time.Second)
+	for len(boards) < 3 || !gap {
+		select {
+		case e := <-book.Events():
+			switch e := e.(type) {
+			case BookEvent:
+				boards = append(boards, e)
+			case StatusEvent:
+				gap = gap || e.Type == exchange.StreamGap
+			}
+		case <-timeout:
+			t.Fatalf("boards = %+v, gap = %v", boards, gap)
+		}
+	}
+
+	updated := boards[1].Board
+	if len(updated.Asks) != 2 || updated.Asks[0].Price != 3000 || updated.Bids[0].Size != 5 || updated.MidPrice != 2999.5 {
+		t.Errorf("board after delta = %+v", updated)
+	}
+	current, ok := book.Board()
+	if !ok || len(current.Asks) != 1 || current.Bids[0].Size != 9 {
+		t.Errorf("board after resync = %+v", current)
+	}
+}
+
+func TestOrderBookWithoutReadingEvents(t *testing.T) {
+	server, url := newFakeWSServer(t, func(conn *websocket.Conn) {
+		expectOp(t, conn, "subscribe", "orderBookL2_25.BTCUSD")
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"topic":"orderBookL2_25.BTCUSD","type":"snapshot","data":[{"price":"2999.00","symbol":"BTCUSD","id":29990000,"side":"Buy","size":1},{"price":"3001.00","symbol":"BTCUSD","id":30010000,"side":"Sell","size":10}],"cross_seq":100}`))
+		for i := 1; i <= 20; i++ {
+			conn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(`{"topic":"orderBookL2_25.BTCUSD","type":"delta","data":{"delete":[],"update":[{"price":"2999.00","symbol":"BTCUSD","id":29990000,"side":"Buy","size":%d}],"insert":[]},"cross_seq":%d}`, i, 100+i)))
+		}
+		conn.ReadMessage()
+	})
+	defer server.Close()
+
+	book, err := SubscribeOrderBook(context.Background(), "BTCUSD", WithStreamURL(url), WithStreamBufferSize(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer book.Close()
+
+	// Eventsは一度も読まない
+	timeout := time.After(3 * time.Second)
+	for {
+		current, ok := book.Board()
+		if ok && len(current.Bids) == 1 && current.Bids[0].Size == 20 {
+			return
+		}
+		select {
+		case <-timeout:
+			t.Fatalf("board = %+v", current)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestSubscribeTicker(t *testing.T) {
+	server, url := newFakeWSServer(t, func(conn *websocket.Conn) {
+		expectOp(t, conn, "subscribe", "instrument_info.100ms.BTCUSD")
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"topic":"instrument_info.100ms.BTCUSD","type":"snapshot","data":{"symbol":"BTCUSD","last_price_e4":81165000,"mark_price_e4":81178500,"index_price_e4":81172800,"bid1_price_e4":81165000,"ask1_price_e4":81165500,"volume_24h":1224245,"turnover_24h_e8":1508976006,"open_interest":154848795,"funding_rate_e6":100,"next_funding_time":"2020-10-13T16:00:00Z","updated_at":"2020-10-13T09:48:40.085Z"},"cross_seq":1}`))
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"topic":"instrument_info.100ms.BTCUSD","type":"delta","data":{"delete":[],"update":[{"symbol":"BTCUSD","mark_price_e4":81180000,"updated_at":"2020-10-13T09:48:40.185Z"}],"insert":[]},"cross_seq":2}`))
+		conn.ReadMessage()
+	})
+	defer server.Close()
+
+	sub, err := SubscribeTicker(context.Background(), "BTCUSD", WithStreamURL(url))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+
+	tickers := []TickerEvent{}
+	timeout := time.After(3 * time.Second)
+	for len(tickers) < 2 {
+		select {
+		case e := <-sub.Events():
+			if e, ok := e.(TickerEvent); ok {
+				tickers = append(tickers, e)
+			}
+		case <-timeout:
+			t.Fatalf("tickers = %+v", tickers)
+		}
+	}
+
+	updated := tickers[1].Ticker
+	// deltaに無いフィールドはsnapshotの値のまま
+	if updated.MarkPrice != 8118 || updated.LastPrice != 8116.5 || updated.FundingRate != 0.0001 || updated.OpenInterest != 154848795 {
+		t.Errorf("ticker after delta = %+v", updated)
+	}
+}
+
+func TestSubscribeKlines(t *testing.T) {
+	server, url := newFakeWSServer(t, func(conn *websocket.Conn) {
+		expectOp(t, conn, "subscribe", "klineV2.1.BTCUSD")
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"topic":"klineV2.1.BTCUSD","data":[{"start":1572425640,"end":1572425700,"open":9200,"close":9202.5,"high":9202.5,"low":9196,"volume":81790,"turnover":8.889247899999999,"confirm":false,"cross_seq":297503256,"timestamp":1572425676958323}],"timestamp_e6":1572425677047994}`))
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"topic":"klineV2.1.BTCUSD","data":[{"start":1572425640,"end":1572425700,"open":9200,"close":9201,"high":9202.5,"low":9196,"volume":82000,"turnover":8.9,"confirm":true,"cross_seq":297503300,"timestamp":1572425700000000}],"timestamp_e6":1572425700000000}`))
+		conn.ReadMessage()
+	})
+	defer server.Close()
+
+	sub, err := SubscribeKlines(context.Background(), "BTCUSD", "1", WithStreamURL(url))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+
+	klines := []KlineEvent{}
+	timeout := time.After(3 * time.Second)
+	for len(klines) < 2 {
+		select {
+		case e := <-sub.Events():
+			if e, ok := e.(KlineEvent); ok {
+				klines = append(klines, e)
+			}
+		case <-timeout:
+			t.Fatalf("klines = %+v", klines)
+		}
+	}
+	if klines[0].Confirmed || klines[0].Close != 9202.5 || klines[0].OpenTime.Unix() != 1572425640 {
+		t.Errorf("in-progress kline = %+v", klines[0])
+	}
+	if !klines[1].Confirmed || klines[1].Close != 9201 {
+		t.Errorf("confirmed kline = %+v", klines[1])
+	}
+}
+
+func TestSubscribeLiquidations(t *testing.T) {
+	server, url := newFakeWSServer(t, func(conn *websocket.Conn) {
+		expectOp(t, conn, "subscribe", "liquidation.BTCUSD")
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"topic":"liquidation.BTCUSD","data":{"symbol":"BTCUSD","side":"Sell","price":"61000.5","qty":"150","time":1634640830000}}`))
+		conn.ReadMessage()
+	})
+	defer server.Close()
+
+	sub, err := SubscribeLiquidations(context.Background(), "BTCUSD", WithStreamURL(url))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+
+	timeout := time.After(3 * time.Second)
+	for {
+		select {
+		case e := <-sub.Events():
+			l, ok := e.(LiquidationEvent)
+			if !ok {
+				continue
+			}
+			if l.Symbol != "BTCUSD" || l.IsBuy || l.Price != 61000.5 || l.Size != 150 || l.OccuredAt.Unix() != 1634640830 {
+				t.Errorf("liquidation = %+v", l)
+			}
+			return
+		case <-timeout:
+			t.Fatal("no liquidation")
+		}
+	}
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	server, url := newFakeWSServer(t, func(conn *websocket.Conn) {
+		expectOp(t, conn, "subscribe", "trade.BTCUSD")
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"topic":"trade.BTCUSD","data":[{"trade_time_ms":1578848399000,"symbol":"BTCUSD","side":"Buy","size":1,"price":8098,"trade_id":"a"}]}`))
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"topic":"trade.BTCUSD","data":[{"trade_time_ms":1578848399001,"symbol":"BTCUSD","side":"Sell","size":2,"price":8097,"trade_id":"b"}]}`))
+		conn.ReadMessage()
+	})
+	defer server.Close()
+
+	dir := t.TempDir()
+	recorder, err := NewRecorder(dir, RotateHourly)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, err := SubscribeTrades(context.Background(), "BTCUSD", WithStreamURL(url), WithRecorder(recorder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	trades := 0
+	for e := range sub.Events() {
+		if _, ok := e.(TradeEvent); ok {
+			trades++
+		}
+		if trades == 2 {
+			sub.Close()
+		}
+	}
+	// 記録時刻が1時間をまたぐとファイルが分かれる
+	next := time.Now().Add(time.Hour)
+	recorder.Record(next, []byte(`{"topic":"trade.BTCUSD","data":[{"trade_time_ms":1578848400000,"symbol":"BTCUSD","side":"Buy","size":3,"price":8099,"trade_id":"c"}]}`))
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := recorder.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := RecordFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("files = %v", files)
+	}
+
+	stream, err := NewReplayStream(0, files...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+	if err := stream.Start(); err != nil {
+		t.Fatal(err)
+	}
+	ids := []string{}
+	timeout := time.After(3 * time.Second)
+	for {
+		e, err := stream.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.LocalID != "" {
+			ids = append(ids, e.LocalID)
+		}
+		select {
+		case <-timeout:
+			t.Fatalf("ids = %v", ids)
+		default:
+		}
+	}
+	if fmt.Sprint(ids) != "[a b c]" {
+		t.Errorf("ids = %v", ids)
+	}
+}
+
+func TestMux(t *testing.T) {
+	var conns int32
+	send := make(chan struct{})
+	unsubscribed := make(chan string, 4)
+	server, url := newFakeWSServer(t, func(conn *websocket.Conn) {
+		atomic.AddInt32(&conns, 1)
+		req := wsRequest{}
+		if err := conn.ReadJSON(&req); err != nil || req.Op != "subscribe" || len(req.Args) != 1 {
+			t.Errorf("req = %+v, err = %v", req, err)
+			return
+		}
+		topic := req.Args[0].(string)
+		<-send
+		symbol := strings.TrimPrefix(topic, "trade.")
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"topic":"`+topic+`","data":[{"trade_time_ms":1578848399000,"symbol":"`+symbol+`","side":"Buy","size":1,"price":8098,"trade_id":"`+symbol+`"}]}`))
+		for {
+			req := wsRequest{}
+			if err := conn.ReadJSON(&req); err != nil {
+				return
+			}
+			if req.Op == "unsubscribe" {
+				unsubscribed <- req.Args[0].(string)
+			}
+		}
+	})
+	defer server.Close()
+
+	// 1接続1topicにして接続が分かれることを確認する
+	mux, err := NewMux(WithStreamURL(url), WithMaxTopicsPerConn(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mux.Close()
+	sub1, err := mux.Subscribe(context.Background(), []string{"trade.BTCUSD", "trade.ETHUSD"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub2, err := mux.Subscribe(context.Background(), []string{"trade.BTCUSD"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	close(send)
+
+	receive := func(sub *Subscription, n int) []string {
+		ids := []string{}
+		timeout := time.After(3 * time.Second)
+		for len(ids) < n {
+			select {
+			case e := <-sub.Events():
+				if trade, ok := e.(TradeEvent); ok {
+					ids = append(ids, trade.LocalID)
+				}
+			case <-timeout:
+				t.Fatalf("ids = %v", ids)
+			}
+		}
+		return ids
+	}
+	if ids := receive(sub1, 2); len(ids) != 2 || ids[0] == ids[1] {
+		t.Errorf("sub1 ids = %v", ids)
+	}
+	if ids := receive(sub2, 1); ids[0] != "BTCUSD" {
+		t.Errorf("sub2 ids = %v", ids)
+	}
+	if n := atomic.LoadInt32(&conns); n != 2 {
+		t.Errorf("connections = %d", n)
+	}
+
+	// sub1がまだ使っているのでBTCUSDは購読したまま
+	sub2.Close()
+	mux.mu.Lock()
+	if len(mux.topics) != 2 || len(mux.topics["trade.BTCUSD"].subs) != 1 {
+		t.Errorf("topics = %+v", mux.topics)
+	}
+	mux.mu.Unlock()
+
+	sub1.Close()
+	got := map[string]bool{}
+	for len(got) < 2 {
+		select {
+		case topic := <-unsubscribed:
+			got[topic] = true
+		case <-time.After(3 * time.Second):
+			t.Fatalf("unsubscribed = %v", got)
+		}
+	}
+	mux.mu.Lock()
+	if len(mux.shards) != 0 {
+		t.Errorf("shards = %d", len(mux.shards))
+	}
+	mux.mu.Unlock()
+}
+
+func TestMuxSlowSubscriber(t *testing.T) {
+	send := make(chan struct{})
+	server, url := newFakeWSServer(t, func(conn *websocket.Conn) {
+		expectOp(t, conn, "subscribe", "trade.BTCUSD")
+		<-send
+		for i := 0; i < 10; i++ {
+			conn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(`{"topic":"trade.BTCUSD","data":[{"trade_time_ms":1578848399000,"symbol":"BTCUSD","side":"Buy","size":1,"price":8098,"trade_id":"%d"}]}`, i)))
+		}
+		conn.ReadMessage()
+	})
+	defer server.Close()
+
+	mux, err := NewMux(WithStreamURL(url), WithStreamBufferSize(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mux.Close()
+	// slowは一度も読まない
+	slow, err := mux.Subscribe(context.Background(), []string{"trade.BTCUSD"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer slow.Close()
+	fast, err := mux.Subscribe(context.Background(), []string{"trade.BTCUSD"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	close(send)
+
+	timeout := time.After(3 * time.Second)
+	for {
+		select {
+		case e := <-fast.Events():
+			if trade, ok := e.(TradeEvent); ok && trade.LocalID == "9" {
+				return
+			}
+		case <-timeout:
+			t.Fatal("fast subscriber must not be blocked by slow one")
+		}
+	}
+}
+
+func TestMuxDialDoesNotBlockDelivery(t *testing.T) {
+	var conns int32
+	dialing := make(chan struct{})
+	accept := make(chan struct{})
+	send := make(chan struct{})
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&conns, 1) == 2 {
+			// 2本目の接続はハンドシェイクを止めておく
+			close(dialing)
+			<-accept
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		req := wsRequest{}
+		if err := conn.ReadJSON(&req); err != nil {
+			return
+		}
+		topic := req.Args[0].(string)
+		<-send
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"topic":"`+topic+`","data":[{"trade_time_ms":1578848399000,"symbol":"BTCUSD","side":"Buy","size":1,"price":8098,"trade_id":"a"}]}`))
+		conn.ReadMessage()
+	}))
+	defer server.Close()
+
+	mux, err := NewMux(WithStreamURL("ws"+strings.TrimPrefix(server.URL, "http")), WithMaxTopicsPerConn(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mux.Close()
+	sub1, err := mux.Subscribe(context.Background(), []string{"trade.BTCUSD"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subscribed := make(chan error, 1)
+	go func() {
+		_, err := mux.Subscribe(context.Background(), []string{"trade.ETHUSD"})
+		subscribed <- err
+	}()
+	<-dialing
+	close(send)
+
+	// 2本目の接続中も1本目の配信は止まらない
+	timeout := time.After(3 * time.Second)
+	for received := false; !received; {
+		select {
+		case e := <-sub1.Events():
+			_, received = e.(TradeEvent)
+		case <-timeout:
+			close(accept)
+			t.Fatal("delivery must not wait for dial of another connection")
+		}
+	}
+
+	close(accept)
+	if err := <-subscribed; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMuxConcurrentDial(t *testing.T) {
+	var active int32
+	server, url := newFakeWSServer(t, func(conn *websocket.Conn) {
+		atomic.AddInt32(&active, 1)
+		defer atomic.AddInt32(&active, -1)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+	defer server.Close()
+
+	// 2つの購読が両方とも接続を始めるまでdialを止める
+	var dials int32
+	both := make(chan struct{})
+	dialer := &websocket.Dialer{NetDial: func(network, addr string) (net.Conn, error) {
+		if atomic.AddInt32(&dials, 1) == 2 {
+			close(both)
+		}
+		select {
+		case <-both:
+		case <-time.After(3 * time.Second):
+		}
+		return net.Dial(network, addr)
+	}}
+	mux, err := NewMux(WithStreamURL(url), WithStreamDialer(dialer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mux.Close()
+
+	errs := make(chan error, 2)
+	for _, topic := range []string{"trade.BTCUSD", "trade.ETHUSD"} {
+		go func(topic string) {
+			_, err := mux.Subscribe(context.Background(), []string{topic})
+			errs <- err
+		}(topic)
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 後から接続した側は先の接続に相乗りし、自分の接続はすぐに閉じる
+	mux.mu.Lock()
+	shards, topics := len(mux.shards), len(mux.topics)
+	mux.mu.Unlock()
+	if shards != 1 || topics != 2 {
+		t.Errorf("shards = %d, topics = %d", shards, topics)
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for atomic.LoadInt32(&active) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("active connections = %d", atomic.LoadInt32(&active))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestMuxCloseShardWithBlockedSubscriber(t *testing.T) {
+	server, url := newFakeWSServer(t, func(conn *websocket.Conn) {
+		expectOp(t, conn, "subscribe", "trade.BTCUSD")
+		for i := 0; i < 5; i++ {
+			conn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(`{"topic":"trade.BTCUSD","data":[{"trade_time_ms":1578848399000,"symbol":"BTCUSD","side":"Buy","size":1,"price":8098,"trade_id":"%d"}]}`, i)))
+		}
+		conn.ReadMessage()
+	})
+	defer server.Close()
+
+	mux, err := NewMux(WithStreamURL(url))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mux.Close()
+	// 読まない購読者への配信で受信が止まる
+	sub, err := mux.Subscribe(context.Background(), []string{"trade.BTCUSD"}, WithBackpressure(BackpressureBlock), WithStreamBufferSize(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for len(sub.Events()) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("events not received")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// releaseやCloseと同じく、外してから閉じる
+	mux.mu.Lock()
+	shard := mux.shards[0]
+	mux.removeShardLocked(shard)
+	mux.mu.Unlock()
+	closed := make(chan struct{})
+	go func() {
+		shard.conn.close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(3 * time.Second):
+		t.Fatal("closing connection must not wait for blocked subscriber")
+	}
+}
+
+func TestMuxSubscribeRejected(t *testing.T) {
+	server, url := newFakeWSServer(t, func(conn *websocket.Conn) {
+		for {
+			req := wsRequest{}
+			if err := conn.ReadJSON(&req); err != nil {
+				return
+			}
+			if req.Op != "subscribe" {
+				continue
+			}
+			topic := req.Args[0].(string)
+			if topic != "trade.NOPE" {
+				conn.WriteMessage(websocket.TextMessage, []byte(`{"success":true,"ret_msg":"","request":{"op":"subscribe","args":["`+topic+`"]}}`))
+				continue
+			}
+			conn.WriteMessage(websocket.TextMessage, []byte(`{"success":false,"ret_msg":"error:handler not found,topic:trade.NOPE","request":{"op":"subscribe","args":["trade.NOPE"]}}`))
+			conn.WriteMessage(websocket.TextMessage, []byte(`{"topic":"trade.BTCUSD","data":[{"trade_time_ms":1578848399000,"symbol":"BTCUSD","side":"Buy","size":1,"price":8098,"trade_id":"a"}]}`))
+		}
+	})
+	defer server.Close()
+
+	mux, err := NewMux(WithStreamURL(url))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mux.Close()
+	good, err := mux.Subscribe(context.Background(), []string{"trade.BTCUSD"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bad, err := mux.Subscribe(context.Background(), []string{"trade.NOPE"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-bad.Done():
+	case <-time.After(3 * time.Second):
+		t.Fatal("rejected subscription must stop")
+	}
+	if bad.Err() == nil || !strings.Contains(bad.Err().Error(), "subscribe failed") {
+		t.Errorf("err = %v", bad.Err())
+	}
+
+	// 同じ接続の他の購読は続く
+	timeout := time.After(3 * time.Second)
+	for received := false; !received; {
+		select {
+		case e, ok := <-good.Events():
+			if !ok {
+				t.Fatalf("good subscription stopped: %v", good.Err())
+			}
+			_, received = e.(TradeEvent)
+		case <-timeout:
+			t.Fatal("trade must be delivered")
+		}
+	}
+	mux.mu.Lock()
+	if len(mux.topics) != 1 || len(mux.shards) != 1 {
+		t.Errorf("topics = %v, shards = %d", mux.topics, len(mux.shards))
+	}
+	mux.mu.Unlock()
+}
+
+func TestSubscribePrivate(t *testing.T) {
+	server, url := newFakeWSServer(t, func(conn *websocket.Conn) {
+		auth := wsRequest{}
+		conn.ReadJSON(&auth)
+		if auth.Op != "auth" || len(auth.Args) != 3 || auth.Args[0] != "hoge" {
+			t.Errorf("auth = %+v", auth)
+			return
+		}
+		// hex(HMAC_SHA256("fuga", "GET/realtime1600000000000"))
+		if auth.Args[1] != float64(1600000000000) || auth.Args[2] != "0413fdbf154e90699b7946f9528e5fd0810b4fd4cf3f9240ceff593e2dfe4e1a" {
+			t.Errorf("auth args = %v", auth.Args)
+		}
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"success":true,"ret_msg":"","request":{"op":"auth","args":[]}}`))
+		expectOp(t, conn, "subscribe", TopicOrder, TopicPosition)
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"topic":"order","data":[{"order_id":"xxxx-xxxx","order_link_id":"","symbol":"BTCUSD","side":"Sell","order_type":"Limit","price":"8579.5","qty":1,"time_in_force":"GoodTillCancel","order_status":"PartiallyFilled","leaves_qty":0.5,"cum_exec_qty":0.5,"timestamp":"2020-01-14T14:09:31.778Z"}]}`))
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"topic":"position","data":[{"user_id":1,"symbol":"BTCUSD","size":11,"side":"Sell","entry_price":"8120.25"}]}`))
+		conn.ReadMessage()
+	})
+	defer server.Close()
+
+	sub, err := SubscribePrivate(context.Background(), exchange.Key{APIKey: "hoge", APISecKey: "fuga"}, []string{TopicOrder, TopicPosition}, WithStreamURL(url), WithStreamClock(func() time.Time {
+		// expiresは10秒後
+		return time.Unix(1599999990, 0)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+
+	var gotOrder *OrderEvent
+	var gotPosition *PositionEvent
+	timeout := time.After(3 * time.Second)
+	for gotOrder == nil || gotPosition == nil {
+		select {
+		case e := <-sub.Events():
+			switch e := e.(type) {
+			case OrderEvent:
+				gotOrder = &e
+			case PositionEvent:
+				gotPosition = &e
+			}
+		case <-timeout:
+			t.Fatalf("err = %v", sub.Err())
+		}
+	}
+	if gotOrder.LocalID != "xxxx-xxxx" || gotOrder.Price != 8579.5 || gotOrder.IsBuy || gotOrder.FilledSize != 0.5 || gotOrder.Status != "PartiallyFilled" {
+		t.Errorf("order = %+v", gotOrder)
+	}
+	if gotPosition.Stock.Summary != -11 || !gotPosition.Position.HasShort() || gotPosition.Position.Short[0].Price != 8120.25 {
+		t.Errorf("position = %+v", gotPosition)
+	}
+}
@@ -0,0 +1,269 @@
+package bybit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/TTRSQ/bbwrapper/domains/execution"
+	"github.com/TTRSQ/bbwrapper/interface/exchange"
+)
+
+// Event event delivered by Subscription. 型switchで具体的な型を判別する
+type Event interface {
+	// EventTopic topic of websocket. 接続状態の通知は空文字
+	EventTopic() string
+}
+
+// StatusEvent lifecycle change of underlying connection (disconnect, reconnect, gap...).
+type StatusEvent struct {
+	exchange.StreamEvent
+}
+
+func (e StatusEvent) EventTopic() string {
+	return ""
+}
+
+// TradeEvent public trade.
+type TradeEvent struct {
+	Topic string
+	execution.Execution
+}
+
+func (e TradeEvent) EventTopic() string {
+	return e.Topic
+}
+
+// BackpressurePolicy behavior when subscriber can not keep up with events.
+type BackpressurePolicy int
+
+const (
+	// BackpressureBlock 受け手が読むまで受信を止める
+	BackpressureBlock BackpressurePolicy = iota
+	// BackpressureDropOldest 古いイベントから捨てる
+	BackpressureDropOldest
+	// BackpressureError ErrSlowConsumerで購読を終了する
+	BackpressureError
+)
+
+// ErrSlowConsumer returned by Subscription.Err when BackpressureError policy stopped the subscription.
+var ErrSlowConsumer = errors.New("bybit: subscriber can not keep up with events")
+
+// WithBackpressure set policy when buffer of subscription is full.
+// default: BackpressureBlock (SubscribeOrderBookとMuxはBackpressureDropOldest)
+func WithBackpressure(policy BackpressurePolicy) StreamOption {
+	return func(c *streamConfig) error {
+		if policy < BackpressureBlock || policy > BackpressureError {
+			return fmt.Errorf("bybit: unknown backpressure policy %d", policy)
+		}
+		c.backpressure = policy
+		return nil
+	}
+}
+
+// Subscription channel based stream of events.
+type Subscription struct {
+	// conn 専用の接続. Muxの購読ではnil
+	conn    *wsConn
+	stop    func()
+	policy  BackpressurePolicy
+	out     chan Event
+	closing chan struct{}
+	done    chan struct{}
+
+	mu        sync.Mutex
+	err       error
+	closeOnce sync.Once
+
+	// outMu finishでoutを閉じた後に送らないためのlock
+	outMu    sync.RWMutex
+	finished bool
+}
+
+// SubscribeTrades subscribe public trades of symbol. ctxがキャンセルされると購読を終了する
+func SubscribeTrades(ctx context.Context, symbol string, opts ...StreamOption) (*Subscription, error) {
+	return subscribe(ctx, opts, []string{"trade." + symbol}, decodeTradeEvents)
+}
+
+func decodeTradeEvents(frame wsFrame) ([]Event, error) {
+	executions, err := decodeTrades(frame.Data)
+	if err != nil {
+		return nil, err
+	}
+	events := make([]Event, len(executions))
+	for i, e := range executions {
+		events[i] = TradeEvent{Topic: frame.Topic, Execution: e}
+	}
+	return events, nil
+}
+
+// subscribe connect websocket and deliver events decoded from frames of topics.
+func subscribe(ctx context.Context, opts []StreamOption, topics []string, decode func(frame wsFrame) ([]Event, error)) (*Subscription, error) {
+	s, err := newSubscription(opts, topics, decode)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.start(ctx); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func newSubscription(opts []StreamOption, topics []string, decode func(frame wsFrame) ([]Event, error)) (*Subscription, error) {
+	config, err := newStreamConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	s := newSubscriptionOf(config)
+	s.conn = newWSConn(config, topics, func(frame wsFrame) error {
+		events, err := decode(frame)
+		for _, e := range events {
+			if err := s.send(e); err != nil {
+				return err
+			}
+		}
+		return err
+	})
+	s.stop = func() {
+		s.conn.close()
+	}
+	return s, nil
+}
+
+func newSubscriptionOf(config *streamConfig) *Subscription {
+	return &Subscription{
+		policy:  config.backpressure,
+		out:     make(chan Event, config.bufferSize),
+		closing: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+func (s *Subscription) start(ctx context.Context) error {
+	if err := s.conn.start(); err != nil {
+		return err
+	}
+
+	go s.forwardStatus()
+	s.watch(ctx)
+	return nil
+}
+
+// watch close subscription when ctx is done.
+func (s *Subscription) watch(ctx context.Context) {
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.setErr(ctx.Err())
+			s.Close()
+		case <-s.done:
+		}
+	}()
+}
+
+// forwardStatus deliver connection events until the connection stops, then close Events.
+func (s *Subscription) forwardStatus() {
+	for e := range s.conn.events {
+		if err := s.send(StatusEvent{e}); errors.Is(err, ErrSlowConsumer) {
+			s.setErr(err)
+			go s.Close()
+		}
+	}
+	if err := s.conn.lastErr(); err != nil && !errors.Is(err, errStreamClosed) {
+		s.setErr(err)
+	}
+	s.finish()
+}
+
+// finish close Events and Done. 一度だけ呼ぶ
+func (s *Subscription) finish() {
+	s.outMu.Lock()
+	s.finished = true
+	close(s.out)
+	s.outMu.Unlock()
+	close(s.done)
+}
+
+// send deliver event unless subscription finished.
+func (s *Subscription) send(e Event) error {
+	return s.sendUntil(e, nil)
+}
+
+// sendUntil send but give up when abort is closed. 共有接続を閉じる時に詰まった配信で待たないため
+func (s *Subscription) sendUntil(e Event, abort <-chan struct{}) error {
+	s.outMu.RLock()
+	defer s.outMu.RUnlock()
+	if s.finished {
+		return errStreamClosed
+	}
+	return s.deliver(e, abort)
+}
+
+func (s *Subscription) deliver(e Event, abort <-chan struct{}) error {
+	switch s.policy {
+	case BackpressureDropOldest:
+		for {
+			select {
+			case s.out <- e:
+				return nil
+			default:
+			}
+			select {
+			case <-s.out:
+			default:
+			}
+		}
+	case BackpressureError:
+		select {
+		case s.out <- e:
+			return nil
+		default:
+			return ErrSlowConsumer
+		}
+	}
+
+	select {
+	case s.out <- e:
+		return nil
+	case <-s.closing:
+		return errStreamClosed
+	case <-abort:
+		return errStreamClosed
+	}
+}
+
+func (s *Subscription) setErr(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err == nil {
+		s.err = err
+	}
+}
+
+// Events channel of events. 購読が終了するとcloseされる
+func (s *Subscription) Events() <-chan Event {
+	return s.out
+}
+
+// Done closed when subscription stopped.
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err return reason of stop. Closeによる終了ならnil、ctxによる終了ならctx.Err()
+func (s *Subscription) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Close stop subscription and close Events.
+func (s *Subscription) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.closing)
+		s.stop()
+	})
+	<-s.done
+	return nil
+}
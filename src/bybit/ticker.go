@@ -0,0 +1,171 @@
+package bybit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/TTRSQ/bbwrapper/domains/ticker"
+)
+
+func (bb *bybit) Ticker(symbol string) (ticker.Ticker, error) {
+	return bb.TickerCtx(context.Background(), symbol)
+}
+
+func (bb *bybit) TickerCtx(ctx context.Context, symbol string) (ticker.Ticker, error) {
+	type Req struct {
+		Symbol string `json:"symbol"`
+	}
+	res, err := bb.getRequest(ctx, "/v2/public/tickers", structToMap(&Req{
+		Symbol: symbol,
+	}))
+	if err != nil {
+		return ticker.Ticker{}, err
+	}
+	// レスポンスの変換
+	type Res struct {
+		RetCode int    `json:"ret_code"`
+		RetMsg  string `json:"ret_msg"`
+		ExtCode string `json:"ext_code"`
+		ExtInfo string `json:"ext_info"`
+		Result  []struct {
+			Symbol          string `json:"symbol"`
+			BidPrice        number `json:"bid_price"`
+			AskPrice        number `json:"ask_price"`
+			LastPrice       number `json:"last_price"`
+			MarkPrice       number `json:"mark_price"`
+			IndexPrice      number `json:"index_price"`
+			OpenInterest    number `json:"open_interest"`
+			Turnover24h     number `json:"turnover_24h"`
+			Volume24h       number `json:"volume_24h"`
+			FundingRate     number `json:"funding_rate"`
+			NextFundingTime string `json:"next_funding_time"`
+		} `json:"result"`
+		TimeNow number `json:"time_now"`
+	}
+	resData := Res{}
+	if err := decode("/v2/public/tickers", res, &resData); err != nil {
+		return ticker.Ticker{}, err
+	}
+	if len(resData.Result) == 0 {
+		return ticker.Ticker{}, fmt.Errorf("bybit: /v2/public/tickers: no ticker for %s", symbol)
+	}
+
+	v := resData.Result[0]
+	nextFundingTime, _ := time.Parse(time.RFC3339Nano, v.NextFundingTime)
+	return ticker.Ticker{
+		Symbol:          v.Symbol,
+		LastPrice:       float64(v.LastPrice),
+		MarkPrice:       float64(v.MarkPrice),
+		IndexPrice:      float64(v.IndexPrice),
+		BestBid:         float64(v.BidPrice),
+		BestAsk:         float64(v.AskPrice),
+		Volume24h:       float64(v.Volume24h),
+		Turnover24h:     float64(v.Turnover24h),
+		OpenInterest:    float64(v.OpenInterest),
+		FundingRate:     float64(v.FundingRate),
+		NextFundingTime: nextFundingTime,
+		UpdatedAt:       time.Unix(0, int64(float64(resData.TimeNow)*float64(time.Second))),
+	}, nil
+}
+
+// TickerEvent update of instrument info.
+type TickerEvent struct {
+	Topic string
+	ticker.Ticker
+}
+
+func (e TickerEvent) EventTopic() string {
+	return e.Topic
+}
+
+// wsInstrument item of instrument_info topic. 価格は1e4倍、資金調達率は1e6倍の整数で届く
+type wsInstrument struct {
+	Symbol          string `json:"symbol"`
+	LastPriceE4     number `json:"last_price_e4"`
+	MarkPriceE4     number `json:"mark_price_e4"`
+	IndexPriceE4    number `json:"index_price_e4"`
+	Bid1PriceE4     number `json:"bid1_price_e4"`
+	Ask1PriceE4     number `json:"ask1_price_e4"`
+	Volume24h       number `json:"volume_24h"`
+	Turnover24hE8   number `json:"turnover_24h_e8"`
+	OpenInterest    number `json:"open_interest"`
+	FundingRateE6   number `json:"funding_rate_e6"`
+	NextFundingTime string `json:"next_funding_time"`
+	UpdatedAt       string `json:"updated_at"`
+}
+
+func (v wsInstrument) ticker() ticker.Ticker {
+	nextFundingTime, _ := time.Parse(time.RFC3339Nano, v.NextFundingTime)
+	updatedAt, _ := time.Parse(time.RFC3339Nano, v.UpdatedAt)
+	return ticker.Ticker{
+		Symbol:          v.Symbol,
+		LastPrice:       float64(v.LastPriceE4) / 1e4,
+		MarkPrice:       float64(v.MarkPriceE4) / 1e4,
+		IndexPrice:      float64(v.IndexPriceE4) / 1e4,
+		BestBid:         float64(v.Bid1PriceE4) / 1e4,
+		BestAsk:         float64(v.Ask1PriceE4) / 1e4,
+		Volume24h:       float64(v.Volume24h),
+		Turnover24h:     float64(v.Turnover24hE8) / 1e8,
+		OpenInterest:    float64(v.OpenInterest),
+		FundingRate:     float64(v.FundingRateE6) / 1e6,
+		NextFundingTime: nextFundingTime,
+		UpdatedAt:       updatedAt,
+	}
+}
+
+// SubscribeTicker subscribe instrument info of symbol. snapshotにdeltaを重ねた最新の値がTickerEventで届く
+func SubscribeTicker(ctx context.Context, symbol string, opts ...StreamOption) (*Subscription, error) {
+	d := &tickerDecoder{}
+	sub, err := newSubscription(opts, []string{"instrument_info.100ms." + symbol}, d.decode)
+	if err != nil {
+		return nil, err
+	}
+	// 再接続後はsnapshotから作り直す
+	sub.conn.onDisconnect = d.reset
+
+	if err := sub.start(ctx); err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+// tickerDecoder merge delta of instrument_info into latest snapshot.
+type tickerDecoder struct {
+	current *wsInstrument
+}
+
+func (d *tickerDecoder) reset() {
+	d.current = nil
+}
+
+func (d *tickerDecoder) decode(frame wsFrame) ([]Event, error) {
+	switch frame.Type {
+	case "snapshot":
+		snapshot := wsInstrument{}
+		if err := json.Unmarshal(frame.Data, &snapshot); err != nil {
+			return nil, fmt.Errorf("bybit: decode instrument info snapshot: %w", err)
+		}
+		d.current = &snapshot
+	case "delta":
+		if d.current == nil {
+			return nil, &wsResyncError{reason: "instrument info delta before snapshot"}
+		}
+		delta := struct {
+			Update []json.RawMessage `json:"update"`
+		}{}
+		if err := json.Unmarshal(frame.Data, &delta); err != nil {
+			return nil, fmt.Errorf("bybit: decode instrument info delta: %w", err)
+		}
+		// deltaには変わったフィールドだけが入っているので前回の値に上書きする
+		for _, update := range delta.Update {
+			if err := json.Unmarshal(update, d.current); err != nil {
+				return nil, fmt.Errorf("bybit: decode instrument info delta: %w", err)
+			}
+		}
+	default:
+		return nil, nil
+	}
+	return []Event{TickerEvent{Topic: frame.Topic, Ticker: d.current.ticker()}}, nil
+}
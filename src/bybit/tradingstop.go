@@ -0,0 +1,70 @@
+package bybit
+
+import (
+	"context"
+	"errors"
+
+	"github.com/TTRSQ/bbwrapper/domains/position"
+)
+
+func (bb *bybit) SetTradingStop(ts position.TradingStop) error {
+	return bb.SetTradingStopCtx(context.Background(), ts)
+}
+
+func (bb *bybit) SetTradingStopCtx(ctx context.Context, ts position.TradingStop) error {
+	if ts.TakeProfit == nil && ts.StopLoss == nil && ts.TrailingStop == nil && ts.TrailingActive == nil {
+		return errors.New("bybit: nothing to set on trading stop")
+	}
+	for _, v := range []*float64{ts.TakeProfit, ts.StopLoss, ts.TrailingStop, ts.TrailingActive} {
+		if v != nil && *v < 0 {
+			return errors.New("bybit: trading stop must not be negative")
+		}
+	}
+	if err := bb.checkTriggerBy(ts.TpTriggerBy); err != nil {
+		return err
+	}
+	if err := bb.checkTriggerBy(ts.SlTriggerBy); err != nil {
+		return err
+	}
+
+	// 0は解除の意味があるのでpointerで未指定と区別する
+	type Req struct {
+		Symbol            string   `json:"symbol"`
+		TakeProfit        *float64 `json:"take_profit"`
+		StopLoss          *float64 `json:"stop_loss"`
+		TrailingStop      *float64 `json:"trailing_stop"`
+		TpTriggerBy       string   `json:"tp_trigger_by,omitempty"`
+		SlTriggerBy       string   `json:"sl_trigger_by,omitempty"`
+		NewTrailingActive *float64 `json:"new_trailing_active"`
+	}
+	res, err := bb.postRequest(ctx, "/v2/private/position/trading-stop", structToMap(&Req{
+		Symbol:            ts.Symbol,
+		TakeProfit:        ts.TakeProfit,
+		StopLoss:          ts.StopLoss,
+		TrailingStop:      ts.TrailingStop,
+		TpTriggerBy:       ts.TpTriggerBy,
+		SlTriggerBy:       ts.SlTriggerBy,
+		NewTrailingActive: ts.TrailingActive,
+	}))
+	if err != nil {
+		return err
+	}
+
+	type Res struct {
+		RetCode int    `json:"ret_code"`
+		RetMsg  string `json:"ret_msg"`
+		ExtCode string `json:"ext_code"`
+		ExtInfo string `json:"ext_info"`
+		Result  struct {
+			Symbol       string `json:"symbol"`
+			Side         string `json:"side"`
+			Size         number `json:"size"`
+			TakeProfit   number `json:"take_profit"`
+			StopLoss     number `json:"stop_loss"`
+			TrailingStop number `json:"trailing_stop"`
+		} `json:"result"`
+		TimeNow string `json:"time_now"`
+	}
+	resData := Res{}
+	return decode("/v2/private/position/trading-stop", res, &resData)
+}
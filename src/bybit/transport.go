@@ -0,0 +1,47 @@
+package bybit
+
+import "net/http"
+
+// Middleware wrap RoundTripper of every api request (logging, metrics, tracing, fault injection...).
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+// RoundTripperFunc adapter to use func as http.RoundTripper.
+type RoundTripperFunc func(req *http.Request) (*http.Response, error)
+
+// RoundTrip call f(req).
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// chainMiddlewares 先に登録したものが外側になるように包む
+func chainMiddlewares(base http.RoundTripper, mws []Middleware) http.RoundTripper {
+	rt := base
+	for i := len(mws) - 1; i >= 0; i-- {
+		rt = mws[i](rt)
+	}
+	return rt
+}
+
+// buildHTTPClient apply timeout, transport and middlewares to copy of client.
+// WithHTTPClientで渡されたclientは変更しない
+func (bb *bybit) buildHTTPClient() {
+	if bb.timeout == 0 && bb.transport == nil && len(bb.middlewares) == 0 {
+		return
+	}
+
+	client := *bb.httpClient
+	if bb.timeout > 0 {
+		client.Timeout = bb.timeout
+	}
+	if bb.transport != nil {
+		client.Transport = bb.transport
+	}
+	if len(bb.middlewares) > 0 {
+		base := client.Transport
+		if base == nil {
+			base = http.DefaultTransport
+		}
+		client.Transport = chainMiddlewares(base, bb.middlewares)
+	}
+	bb.httpClient = &client
+}
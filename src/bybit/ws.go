@@ -0,0 +1,645 @@
+package bybit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/TTRSQ/bbwrapper/interface/exchange"
+	"github.com/gorilla/websocket"
+)
+
+var streamURLs = map[Environment]string{
+	Mainnet:       "wss://stream.bybit.com/realtime",
+	MainnetBytick: "wss://stream.bytick.com/realtime",
+	Testnet:       "wss://stream-testnet.bybit.com/realtime",
+}
+
+// StreamOption optional setting of websocket stream.
+type StreamOption func(c *streamConfig) error
+
+type streamConfig struct {
+	url          string
+	dialer       *websocket.Dialer
+	bufferSize   int
+	pingInterval time.Duration
+	stallTimeout time.Duration
+	reconnectMin time.Duration
+	reconnectMax time.Duration
+	maxReconnect int
+	backpressure BackpressurePolicy
+	bookDepth    int
+	recorder     *Recorder
+	maxTopics    int
+	now          func() time.Time
+}
+
+func newStreamConfig(opts []StreamOption) (*streamConfig, error) {
+	c := &streamConfig{
+		url:        streamURLs[Mainnet],
+		dialer:     websocket.DefaultDialer,
+		bufferSize: 1024,
+		// bybitは20秒毎のpingを推奨している
+		pingInterval: 20 * time.Second,
+		stallTimeout: 60 * time.Second,
+		reconnectMin: 500 * time.Millisecond,
+		reconnectMax: 30 * time.Second,
+		bookDepth:    25,
+		now:          time.Now,
+	}
+	for _, opt := range opts {
+		if err := opt(c); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// WithStreamEnvironment select mainnet or testnet. default: Mainnet
+func WithStreamEnvironment(env Environment) StreamOption {
+	return func(c *streamConfig) error {
+		rawURL, ok := streamURLs[env]
+		if !ok {
+			return fmt.Errorf("bybit: unknown environment %d", env)
+		}
+		c.url = rawURL
+		return nil
+	}
+}
+
+// WithStreamURL set arbitrary websocket url (e.g. "ws://127.0.0.1:8080" for local fake server).
+func WithStreamURL(rawURL string) StreamOption {
+	return func(c *streamConfig) error {
+		if rawURL == "" {
+			return errors.New("bybit: stream url must not be empty")
+		}
+		c.url = rawURL
+		return nil
+	}
+}
+
+// WithStreamClock replace time.Now used for expires of private stream auth.
+// ローカル時計がずれている場合はサーバー時刻とのoffsetを足した時刻を返す関数を渡す
+//
+//	st, _ := client.(exchange.ServerClock).ServerTime()
+//	offset := time.Until(st)
+//	bybit.WithStreamClock(func() time.Time { return time.Now().Add(offset) })
+func WithStreamClock(now func() time.Time) StreamOption {
+	return func(c *streamConfig) error {
+		if now == nil {
+			return errors.New("bybit: stream clock must not be nil")
+		}
+		c.now = now
+		return nil
+	}
+}
+
+// WithStreamDialer use given websocket dialer (proxy, tls config...).
+func WithStreamDialer(dialer *websocket.Dialer) StreamOption {
+	return func(c *streamConfig) error {
+		if dialer == nil {
+			return errors.New("bybit: dialer must not be nil")
+		}
+		c.dialer = dialer
+		return nil
+	}
+}
+
+// WithStreamBufferSize set number of buffered messages. default: 1024
+func WithStreamBufferSize(size int) StreamOption {
+	return func(c *streamConfig) error {
+		if size <= 0 {
+			return fmt.Errorf("bybit: buffer size must be positive: %d", size)
+		}
+		c.bufferSize = size
+		return nil
+	}
+}
+
+// WithHeartbeat set ping interval and stall timeout. default: 20s, 60s
+// stallTimeoutの間なにも受信しなければ切断とみなして再接続する
+func WithHeartbeat(pingInterval, stallTimeout time.Duration) StreamOption {
+	return func(c *streamConfig) error {
+		if pingInterval <= 0 || stallTimeout <= pingInterval {
+			return fmt.Errorf("bybit: invalid heartbeat ping: %s, stall: %s", pingInterval, stallTimeout)
+		}
+		c.pingInterval = pingInterval
+		c.stallTimeout = stallTimeout
+		return nil
+	}
+}
+
+// WithReconnect set backoff of reconnection. maxAttemptsが0なら無制限に再接続する
+func WithReconnect(minWait, maxWait time.Duration, maxAttempts int) StreamOption {
+	return func(c *streamConfig) error {
+		if minWait <= 0 || maxWait < minWait || maxAttempts < 0 {
+			return fmt.Errorf("bybit: invalid reconnect setting min: %s, max: %s, attempts: %d", minWait, maxWait, maxAttempts)
+		}
+		c.reconnectMin = minWait
+		c.reconnectMax = maxWait
+		c.maxReconnect = maxAttempts
+		return nil
+	}
+}
+
+// wsRequest operation sent to bybit websocket.
+type wsRequest struct {
+	Op   string        `json:"op"`
+	Args []interface{} `json:"args"`
+}
+
+// wsFrame envelope of every message from bybit websocket.
+// topicのあるものはデータ、ないものはsubscribe, pingなどへの応答
+type wsFrame struct {
+	Topic string          `json:"topic"`
+	Type  string          `json:"type"`
+	Data  json.RawMessage `json:"data"`
+	// CrossSeq 板など連続性のあるtopicのシーケンス番号
+	CrossSeq number     `json:"cross_seq"`
+	Success  *bool      `json:"success"`
+	RetMsg   string     `json:"ret_msg"`
+	Request  *wsRequest `json:"request"`
+}
+
+// wsConn websocket connection subscribing topics.
+// 切断、無通信を検知すると再接続して全topicを購読し直し、StreamGapを通知する
+type wsConn struct {
+	config  *streamConfig
+	handler func(frame wsFrame) error
+	events  chan exchange.StreamEvent
+	// auth 購読前に送る認証リクエストを作る
+	auth func() wsRequest
+	// onDisconnect 再接続前にhandlerと同じgoroutineで呼ばれる (板のリセットなど)
+	onDisconnect func()
+	// onTopicError subscribe, unsubscribeの拒否を接続全体のエラーにせずhandlerと同じgoroutineで渡す
+	// nilなら拒否された時点でstreamを止める. 設定すると拒否されたtopicが分かるよう1つずつ購読する
+	onTopicError func(op string, topics []string, err error)
+
+	writeMu sync.Mutex
+	conn    *websocket.Conn
+	// live 現在の接続で全topicの購読を送り終えていればtrue
+	live bool
+
+	mu      sync.Mutex
+	topics  []string
+	err     error
+	running bool
+	closed  bool
+	closeCh chan struct{}
+	done    chan struct{}
+
+	// pending eventsに渡せていないイベント. forwardが順に渡す
+	pendingMu sync.Mutex
+	pending   []exchange.StreamEvent
+	notify    chan struct{}
+	forwarded chan struct{}
+}
+
+func newWSConn(config *streamConfig, topics []string, handler func(frame wsFrame) error) *wsConn {
+	return &wsConn{
+		config:    config,
+		topics:    topics,
+		handler:   handler,
+		events:    make(chan exchange.StreamEvent, 16),
+		closeCh:   make(chan struct{}),
+		done:      make(chan struct{}),
+		notify:    make(chan struct{}, 1),
+		forwarded: make(chan struct{}),
+	}
+}
+
+// start connect and subscribe topics, then read messages in background.
+func (w *wsConn) start() error {
+	conn, err := w.connect()
+	if err != nil {
+		return err
+	}
+
+	// 接続中にcloseされた場合はrunを起動しない (closeがdoneを待たずにeventsを閉じている)
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		conn.Close()
+		return errStreamClosed
+	}
+	w.running = true
+	// runより先に送り、runの切断通知やeventsのcloseと前後しないようにする
+	w.emit(exchange.StreamConnected, nil)
+	go w.run(conn)
+	go w.forward()
+	w.mu.Unlock()
+	return nil
+}
+
+// connect dial and subscribe all topics.
+func (w *wsConn) connect() (*websocket.Conn, error) {
+	conn, _, err := w.config.dialer.Dial(w.config.url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("bybit: dial %s: %w", w.config.url, err)
+	}
+
+	w.writeMu.Lock()
+	if w.isClosed() {
+		w.writeMu.Unlock()
+		conn.Close()
+		return nil, errStreamClosed
+	}
+	w.conn = conn
+	w.live = false
+	w.writeMu.Unlock()
+
+	// privateなtopicは接続毎に認証してから購読する
+	if w.auth != nil {
+		if err := w.send(w.auth()); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	// 途中でsubscribeされたtopicを二重に購読しないよう、送り終えるまでwriteMuを持つ
+	w.writeMu.Lock()
+	defer w.writeMu.Unlock()
+	w.mu.Lock()
+	topics := append([]string{}, w.topics...)
+	w.mu.Unlock()
+	batches := [][]string{topics}
+	if w.onTopicError != nil {
+		batches = make([][]string, len(topics))
+		for i, topic := range topics {
+			batches[i] = []string{topic}
+		}
+	}
+	for _, batch := range batches {
+		if len(batch) == 0 {
+			continue
+		}
+		if err := w.write(wsRequest{Op: "subscribe", Args: stringArgs(batch)}); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	w.live = true
+	return conn, nil
+}
+
+// subscribe add topics. 接続中なら即座に購読し、再接続時にも購読し直す
+func (w *wsConn) subscribe(topics []string) {
+	w.updateTopics("subscribe", topics)
+}
+
+// unsubscribe remove topics.
+func (w *wsConn) unsubscribe(topics []string) {
+	w.updateTopics("unsubscribe", topics)
+}
+
+func (w *wsConn) updateTopics(op string, topics []string) {
+	w.writeMu.Lock()
+	defer w.writeMu.Unlock()
+
+	if op == "subscribe" {
+		w.mu.Lock()
+		w.topics = append(w.topics, topics...)
+		w.mu.Unlock()
+	} else {
+		w.forget(topics)
+	}
+
+	if !w.live {
+		// 接続処理中の購読で送られる
+		return
+	}
+	// 失敗した場合は切断されているので、再接続時のtopicsに任せる
+	w.write(wsRequest{Op: op, Args: stringArgs(topics)})
+}
+
+// forget remove topics without sending unsubscribe (e.g. topics rejected by bybit).
+func (w *wsConn) forget(topics []string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	remain := []string{}
+	for _, t := range w.topics {
+		if !containsString(topics, t) {
+			remain = append(remain, t)
+		}
+	}
+	w.topics = remain
+}
+
+func (w *wsConn) send(req wsRequest) error {
+	w.writeMu.Lock()
+	defer w.writeMu.Unlock()
+	return w.write(req)
+}
+
+// write writeMuを取った状態で呼ぶ
+func (w *wsConn) write(req wsRequest) error {
+	if w.conn == nil {
+		return fmt.Errorf("bybit: websocket %s: not connected", req.Op)
+	}
+	w.conn.SetWriteDeadline(time.Now().Add(w.config.pingInterval))
+	if err := w.conn.WriteJSON(req); err != nil {
+		return fmt.Errorf("bybit: websocket %s: %w", req.Op, err)
+	}
+	return nil
+}
+
+func (w *wsConn) run(conn *websocket.Conn) {
+	defer close(w.done)
+
+	for {
+		err := w.serve(conn)
+		if w.isClosed() {
+			return
+		}
+		var fatal *wsFatalError
+		if errors.As(err, &fatal) {
+			w.fail(fatal.err)
+			w.emit(exchange.StreamDisconnected, fatal.err)
+			return
+		}
+		if w.onDisconnect != nil {
+			w.onDisconnect()
+		}
+		w.emit(exchange.StreamDisconnected, err)
+
+		conn, err = w.reconnect()
+		if err != nil {
+			if !w.isClosed() {
+				w.fail(err)
+			}
+			return
+		}
+		w.emit(exchange.StreamReconnected, nil)
+		// 切断中のデータは取りこぼしている
+		w.emit(exchange.StreamGap, nil)
+	}
+}
+
+// wsFatalError error which must stop the stream without reconnecting (auth, subscribe rejection...).
+type wsFatalError struct {
+	err error
+}
+
+func (e *wsFatalError) Error() string {
+	return e.err.Error()
+}
+
+// serve read messages and send heartbeat until the connection is broken.
+func (w *wsConn) serve(conn *websocket.Conn) error {
+	defer conn.Close()
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go w.heartbeat(stop)
+
+	for {
+		// stallTimeoutの間なにも届かなければ切断とみなす (pingへのpongも含む)
+		conn.SetReadDeadline(time.Now().Add(w.config.stallTimeout))
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		if w.config.recorder != nil {
+			// 記録の失敗ではstreamを止めない (Recorder.Errで確認する)
+			w.config.recorder.Record(time.Now(), msg)
+		}
+
+		frame := wsFrame{}
+		if err := json.Unmarshal(msg, &frame); err != nil {
+			// 壊れたframeだけを捨てて受信を続ける. データだった可能性があるのでGapを通知する
+			w.emit(exchange.StreamGap, fmt.Errorf("bybit: websocket decode: %w", err))
+			continue
+		}
+		if frame.Success != nil && !*frame.Success {
+			op := ""
+			topics := []string{}
+			if frame.Request != nil {
+				op = frame.Request.Op
+				for _, arg := range frame.Request.Args {
+					if topic, ok := arg.(string); ok {
+						topics = append(topics, topic)
+					}
+				}
+			}
+			err := fmt.Errorf("bybit: websocket %s failed: %s", op, frame.RetMsg)
+			if w.onTopicError != nil && (op == "subscribe" || op == "unsubscribe") {
+				w.onTopicError(op, topics, err)
+				continue
+			}
+			return &wsFatalError{err}
+		}
+		if frame.Topic == "" {
+			continue
+		}
+		if err := w.handler(frame); err != nil {
+			var resync *wsResyncError
+			if !errors.As(err, &resync) {
+				return &wsFatalError{err}
+			}
+			if err := w.resubscribe(frame.Topic); err != nil {
+				return err
+			}
+			w.emit(exchange.StreamGap, resync)
+		}
+	}
+}
+
+// wsResyncError returned by handler when topic must be subscribed again to get new snapshot.
+type wsResyncError struct {
+	reason string
+}
+
+func (e *wsResyncError) Error() string {
+	return "bybit: resync: " + e.reason
+}
+
+// resubscribe subscribe topic again to receive new snapshot.
+func (w *wsConn) resubscribe(topic string) error {
+	if err := w.send(wsRequest{Op: "unsubscribe", Args: stringArgs([]string{topic})}); err != nil {
+		return err
+	}
+	return w.send(wsRequest{Op: "subscribe", Args: stringArgs([]string{topic})})
+}
+
+// heartbeat send ping on bybit recommended interval.
+func (w *wsConn) heartbeat(stop chan struct{}) {
+	ticker := time.NewTicker(w.config.pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			// 失敗した場合はreadがstallTimeoutで切れて再接続される
+			w.send(wsRequest{Op: "ping"})
+		}
+	}
+}
+
+// reconnect retry connect with exponential backoff until success or close.
+func (w *wsConn) reconnect() (*websocket.Conn, error) {
+	wait := w.config.reconnectMin
+	for attempt := 1; ; attempt++ {
+		timer := time.NewTimer(wait)
+		select {
+		case <-w.closeCh:
+			timer.Stop()
+			return nil, errStreamClosed
+		case <-timer.C:
+		}
+
+		conn, err := w.connect()
+		if err == nil {
+			return conn, nil
+		}
+		if w.config.maxReconnect > 0 && attempt >= w.config.maxReconnect {
+			return nil, fmt.Errorf("bybit: reconnect failed %d times: %w", attempt, err)
+		}
+		w.emit(exchange.StreamDisconnected, err)
+
+		wait *= 2
+		if wait > w.config.reconnectMax {
+			wait = w.config.reconnectMax
+		}
+	}
+}
+
+// maxPendingEvents これを超えて溜まったら同じ種類のイベントをまとめる
+const maxPendingEvents = 16
+
+// emit notify lifecycle event. 受け手が詰まっていても切断、Gapは捨てずに後から渡す
+func (w *wsConn) emit(t exchange.StreamEventType, err error) {
+	w.pendingMu.Lock()
+	w.pending = append(w.pending, exchange.StreamEvent{Type: t, At: time.Now(), Err: err})
+	if len(w.pending) > maxPendingEvents {
+		w.pending = coalesceEvents(w.pending)
+	}
+	w.pendingMu.Unlock()
+
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+}
+
+// coalesceEvents 種類毎に最後のイベントだけを順序を保って残す
+// 最後の状態と、切断やGapがあったことは受け手に伝わる
+func coalesceEvents(events []exchange.StreamEvent) []exchange.StreamEvent {
+	seen := map[exchange.StreamEventType]bool{}
+	kept := []exchange.StreamEvent{}
+	for i := len(events) - 1; i >= 0; i-- {
+		if seen[events[i].Type] {
+			continue
+		}
+		seen[events[i].Type] = true
+		kept = append([]exchange.StreamEvent{events[i]}, kept...)
+	}
+	return kept
+}
+
+// forward deliver pending events to events in order, then close events after run stopped.
+// closeされた場合は残りを捨てる
+func (w *wsConn) forward() {
+	defer close(w.forwarded)
+	defer close(w.events)
+
+	stopped := w.done
+	for {
+		w.pendingMu.Lock()
+		if len(w.pending) == 0 {
+			w.pendingMu.Unlock()
+			if stopped == nil {
+				return
+			}
+			select {
+			case <-w.notify:
+			case <-stopped:
+				// runが最後に送ったイベントを渡してから終わる
+				stopped = nil
+			case <-w.closeCh:
+				return
+			}
+			continue
+		}
+		e := w.pending[0]
+		w.pending = w.pending[1:]
+		w.pendingMu.Unlock()
+
+		select {
+		case w.events <- e:
+		case <-w.closeCh:
+			return
+		}
+	}
+}
+
+// fail record first error.
+func (w *wsConn) fail(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err == nil {
+		w.err = err
+	}
+}
+
+// lastErr return error which stopped the connection.
+func (w *wsConn) lastErr() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+func (w *wsConn) isClosed() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.closed
+}
+
+var errStreamClosed = errors.New("bybit: stream closed")
+
+func (w *wsConn) close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	close(w.closeCh)
+	running := w.running
+	w.mu.Unlock()
+
+	w.writeMu.Lock()
+	if w.conn != nil {
+		w.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+		// serveの終了時にも閉じられるが、readを止めるためここでも閉じる
+		w.conn.Close()
+	}
+	w.writeMu.Unlock()
+
+	if running {
+		<-w.done
+		<-w.forwarded
+	} else {
+		close(w.events)
+	}
+	return nil
+}
+
+func containsString(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+func stringArgs(values []string) []interface{} {
+	args := make([]interface{}, len(values))
+	for i, v := range values {
+		args[i] = v
+	}
+	return args
+}